@@ -27,6 +27,7 @@ import (
 
 	"opentelemetry-trace-codelab-go/client/shakesapp"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -163,8 +164,13 @@ func mustMapEnv(target *string, envKey string) {
 // Helper function for gRPC connections: Dial and create client once, reuse.
 func mustConnGRPC(ctx context.Context, conn **grpc.ClientConn, addr string) {
 	var err error
+	// step1. propagate the trace context to the server, so that the trace
+	// doesn't stop at the client.
+	interceptorOpt := otelgrpc.WithTracerProvider(otel.GetTracerProvider())
 	*conn, err = grpc.DialContext(ctx, addr,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor(interceptorOpt)),
+		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor(interceptorOpt)),
 		grpc.WithTimeout(time.Second*3),
 	)
 	if err != nil {
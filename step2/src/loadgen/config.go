@@ -43,6 +43,21 @@ var testCases = []query{
 	{"insolence", 14},
 }
 
+// embeddedTestCases are the expected counts when the server falls back to the
+// small corpus embedded in its binary.
+var embeddedTestCases = []query{
+	{"love", 5},
+	{"friend", 2},
+	{"sweet", 3},
+	{"faith", 1},
+	{"sleep", 6},
+	{"romeo", 8},
+	{"brutus", 9},
+	{"to be, or not to be", 1},
+	{"what's past is prologue", 1},
+	{"insolence", 1},
+}
+
 func init() {
 	clientSvcAddr := defaultClientSvcAddr
 	if os.Getenv("CLIENT_SVC_ADDR") != "" {
@@ -85,4 +100,7 @@ func init() {
 		}
 		intervalMs = int(i)
 	}
+	if os.Getenv("CORPUS") == "embedded" {
+		testCases = embeddedTestCases
+	}
 }
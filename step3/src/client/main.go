@@ -32,6 +32,8 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	stdout "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
@@ -103,10 +105,7 @@ func (cs *clientService) health(w http.ResponseWriter, r *http.Request) {
 // step1. add OpenTelemetry initialization function
 func initTracer() (*sdktrace.TracerProvider, error) {
 	// step3. replace stdout exporter with Cloud Trace exporter
-	// cloudtrace.New() finds the credentials to Cloud Trace automatically following the
-	// rules defined by golang.org/x/oauth2/google.findDefaultCredentailsWithParams.
-	// https://pkg.go.dev/golang.org/x/oauth2/google#FindDefaultCredentialsWithParams
-	exporter, err := cloudtrace.New()
+	exporter, err := newExporter()
 	// step3. end replacing exporter
 	if err != nil {
 		return nil, err
@@ -123,6 +122,31 @@ func initTracer() (*sdktrace.TracerProvider, error) {
 	return tp, nil
 }
 
+// newExporter creates the span exporter selected with the OTEL_EXPORTER
+// environment variable, like the shared telemetry package of step 6, so that
+// the same binary works in every step of the codelab:
+//
+//   - "cloudtrace" (default) sends the spans to Cloud Trace.
+//   - "stdout" prints the spans to stdout, like in step 1 and step 2.
+//   - "otlp" sends the spans to the OpenTelemetry Collector at
+//     OTEL_EXPORTER_OTLP_ENDPOINT (localhost:4317 by default).
+func newExporter() (sdktrace.SpanExporter, error) {
+	switch e := os.Getenv("OTEL_EXPORTER"); e {
+	case "", "cloudtrace":
+		// cloudtrace.New() finds the credentials to Cloud Trace automatically following the
+		// rules defined by golang.org/x/oauth2/google.findDefaultCredentailsWithParams.
+		// https://pkg.go.dev/golang.org/x/oauth2/google#FindDefaultCredentialsWithParams
+		return cloudtrace.New()
+	case "stdout":
+		return stdout.New(stdout.WithPrettyPrint())
+	case "otlp":
+		// set OTEL_EXPORTER_OTLP_INSECURE=true to connect without TLS.
+		return otlptracegrpc.New(context.Background())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_EXPORTER %q", e)
+	}
+}
+
 func main() {
 	// step1. setup OpenTelemetry
 	tp, err := initTracer()
@@ -0,0 +1,128 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+const bucketProbeTimeout = 10 * time.Second
+
+// embeddedCorpus is a small excerpt of a few plays that is used when neither
+// the Cloud Storage bucket nor CORPUS_DIR is available.
+//
+//go:embed corpus/*.txt
+var embeddedCorpus embed.FS
+
+// corpusReader returns the content of the texts that GetMatchCount searches.
+type corpusReader func(ctx context.Context) ([]string, error)
+
+// newCorpusReader selects the source of the texts at startup.
+// When CORPUS_DIR is set, the server reads the .txt files in that directory
+// instead of the files in the Cloud Storage bucket, so that the codelab can
+// be completed without access to the bucket. When CORPUS_DIR is not set and
+// the bucket can't be reached either, the server falls back to the corpus
+// embedded in the binary.
+func newCorpusReader() corpusReader {
+	if dir := os.Getenv("CORPUS_DIR"); dir != "" {
+		log.Printf("reading corpus from local directory %s", dir)
+		return func(ctx context.Context) ([]string, error) {
+			return readLocalFiles(ctx, dir)
+		}
+	}
+	if err := probeBucket(context.Background(), bucketName, bucketPrefix); err != nil {
+		log.Printf("can't reach gs://%s/%s, falling back to the embedded corpus: %v", bucketName, bucketPrefix, err)
+		return readEmbeddedFiles
+	}
+	log.Printf("reading corpus from gs://%s/%s", bucketName, bucketPrefix)
+	return func(ctx context.Context) ([]string, error) {
+		return readFiles(ctx, bucketName, bucketPrefix)
+	}
+}
+
+// probeBucket checks that the files within the specified bucket with the
+// specified prefix path can be listed.
+func probeBucket(ctx context.Context, bucketName, prefix string) error {
+	ctx, cancel := context.WithTimeout(ctx, bucketProbeTimeout)
+	defer cancel()
+
+	client, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %s", err)
+	}
+	defer client.Close()
+
+	it := client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	if _, err := it.Next(); err != nil {
+		if err == iterator.Done {
+			return fmt.Errorf("no files in %s starting with %s", bucketName, prefix)
+		}
+		return err
+	}
+	return nil
+}
+
+// readLocalFiles reads the content of the .txt files in the directory dir and
+// returns their content. It fails if the directory has no .txt files or if
+// reading any of the files fails.
+func readLocalFiles(ctx context.Context, dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return []string{}, fmt.Errorf("failed to list files in %s: %v", dir, err)
+	}
+	if len(paths) == 0 {
+		return []string{}, fmt.Errorf("no .txt files found in %s", dir)
+	}
+	ret := make([]string, len(paths))
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return []string{}, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return []string{}, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		ret[i] = string(data)
+	}
+	return ret, nil
+}
+
+// readEmbeddedFiles returns the content of the corpus embedded in the binary.
+func readEmbeddedFiles(ctx context.Context) ([]string, error) {
+	paths, err := fs.Glob(embeddedCorpus, "corpus/*.txt")
+	if err != nil {
+		return []string{}, fmt.Errorf("failed to list embedded files: %v", err)
+	}
+	ret := make([]string, len(paths))
+	for i, path := range paths {
+		data, err := embeddedCorpus.ReadFile(path)
+		if err != nil {
+			return []string{}, fmt.Errorf("failed to read embedded file %s: %v", path, err)
+		}
+		ret[i] = string(data)
+	}
+	return ret, nil
+}
@@ -48,10 +48,14 @@ const (
 type serverService struct {
 	shakesapp.UnimplementedShakespeareServiceServer
 	healthpb.UnimplementedHealthServer
+
+	readCorpus corpusReader
 }
 
 func NewServerService() *serverService {
-	return &serverService{}
+	return &serverService{
+		readCorpus: newCorpusReader(),
+	}
 }
 
 // step2. add OpenTelemetry initialization function
@@ -122,7 +126,7 @@ func main() {
 // TODO: instrument the application to take the latency of the request to Cloud Storage
 func (s *serverService) GetMatchCount(ctx context.Context, req *shakesapp.ShakespeareRequest) (*shakesapp.ShakespeareResponse, error) {
 	resp := &shakesapp.ShakespeareResponse{}
-	texts, err := readFiles(ctx, bucketName, bucketPrefix)
+	texts, err := s.readCorpus(ctx)
 	if err != nil {
 		return resp, fmt.Errorf("fails to read files: %s", err)
 	}
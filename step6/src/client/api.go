@@ -0,0 +1,94 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI document of the API of the client, served on
+// /openapi.json. Update it with the routes and the schemas of the API.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// uiPage is the page served on /ui, which calls /v1/query.
+//
+//go:embed ui.html
+var uiPage []byte
+
+// queryResponse is the body of the responses of /v1/query and of its alias /:
+//
+//	{
+//	  "query": "love",
+//	  "case_sensitive": false,
+//	  "match_mode": "REGEX",
+//	  "match_count": 1234,
+//	  "timing": {"duration_ms": 12.5, "cached": false},
+//	  "request_id": "4bf92f3577b34da6a3ce929d0e0e4736"
+//	}
+//
+// request_id is the ID of the request, which is left out of the results of
+// /v1/queries. The fields of v1 are never removed nor renamed. A response with another
+// schema is served by another version of the API.
+type queryResponse struct {
+	Query         string      `json:"query"`
+	CaseSensitive bool        `json:"case_sensitive"`
+	MatchMode     string      `json:"match_mode"`
+	MatchCount    int64       `json:"match_count"`
+	Timing        queryTiming `json:"timing"`
+	RequestID     string      `json:"request_id,omitempty"`
+}
+
+// queryTiming is the time taken to count the matches of a query, and whether
+// the count came from the response cache of the client.
+type queryTiming struct {
+	DurationMs float64 `json:"duration_ms"`
+	Cached     bool    `json:"cached"`
+}
+
+// apiV1 returns the router of version v1 of the API of the client, which is
+// served under /v1/. Every version has its own router, so that a later
+// version can change its routes and schemas while v1 keeps working.
+func (cs *clientService) apiV1() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /query", cs.route("client.handler", cs.handler))
+	mux.Handle("GET /query/stream", cs.route("client.streamHandler", cs.streamHandler))
+	mux.Handle("GET /batch", cs.route("client.batchHandler", cs.batchHandler))
+	mux.Handle("POST /queries", cs.route("client.queriesHandler", cs.queriesHandler))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(r.Context(), w, http.StatusNotFound, "unknown route: "+r.Method+" /v1"+r.URL.Path)
+	})
+	return withAPIVersion("v1")(mux)
+}
+
+// openAPI serves openAPISpec.
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// ui serves uiPage.
+func ui(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+// route returns h wrapped in a span named operation and in the middlewares
+// of the routes of the API.
+func (cs *clientService) route(operation string, h http.HandlerFunc) http.Handler {
+	return NewChain(tracing(operation)).Use(cs.middlewares...).ThenFunc(h)
+}
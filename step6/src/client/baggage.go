@@ -0,0 +1,88 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc"
+)
+
+type apiVersionKey struct{}
+
+// withAPIVersion returns a middleware that records in the context of the
+// requests the version of the API that serves them, which is sent to the
+// server in the baggage of the calls.
+func withAPIVersion(version string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+		})
+	}
+}
+
+// baggageInjector adds the metadata of the request to the W3C baggage of the
+// calls to the server, which the propagator sends in the baggage header and
+// the server copies onto its spans: the request ID, the version of the API and
+// the name of the pod of the client, from POD_NAME. The entries that the
+// client can't set are removed from the baggage sent by the caller, so that
+// the caller can't spoof them.
+type baggageInjector struct {
+	pod string
+}
+
+func newBaggageInjector() baggageInjector {
+	return baggageInjector{pod: os.Getenv("POD_NAME")}
+}
+
+func (b baggageInjector) unary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(b.outgoing(ctx), method, req, reply, cc, opts...)
+}
+
+func (b baggageInjector) stream(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(b.outgoing(ctx), desc, cc, method, opts...)
+}
+
+func (b baggageInjector) outgoing(ctx context.Context) context.Context {
+	version, _ := ctx.Value(apiVersionKey{}).(string)
+	entries := []struct{ key, value string }{
+		{telemetry.BaggageRequestID, telemetry.RequestIDFromContext(ctx)},
+		{telemetry.BaggageAPIVersion, version},
+		{telemetry.BaggageClientPod, b.pod},
+	}
+	bag := baggage.FromContext(ctx)
+	for _, e := range entries {
+		if e.value == "" {
+			bag = bag.DeleteMember(e.key)
+			continue
+		}
+		m, err := baggage.NewMemberRaw(e.key, e.value)
+		if err == nil {
+			bag, err = bag.SetMember(m)
+		}
+		if err != nil {
+			// the baggage is full: the call is made without the entry.
+			slog.DebugContext(ctx, "failed to add baggage entry", "key", e.key, "error", err)
+			bag = bag.DeleteMember(e.key)
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// serverListScheme is the scheme of the target of the connection when
+// SERVER_SVC_ADDR lists several servers.
+const serverListScheme = "shakesapp"
+
+// serverTarget returns the target of the connection to the servers of addr,
+// with the options to resolve it. addr is either a comma-separated list of
+// addresses, such as "10.0.0.1:5050,10.0.0.2:5050", or a single name, such as
+// the headless Service "serverservice-headless:5050", that DNS resolves to the
+// addresses of all the server pods.
+func serverTarget(addr string) (string, []grpc.DialOption) {
+	if !strings.Contains(addr, ",") {
+		return addr, nil
+	}
+	var state resolver.State
+	for _, a := range strings.Split(addr, ",") {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: strings.TrimSpace(a)})
+	}
+	r := manual.NewBuilderWithScheme(serverListScheme)
+	r.InitialState(state)
+	return serverListScheme + ":///servers", []grpc.DialOption{
+		grpc.WithResolvers(r),
+		// the servers share the name of the first one, which TLS verifies
+		// unless TLS_SERVER_NAME is set.
+		grpc.WithAuthority(state.Addresses[0].Addr),
+	}
+}
+
+// loadBalancingPolicy reads the load balancing policy of the connection from
+// SERVER_LB_POLICY: "round_robin", the default, spreads the calls over all the
+// addresses of the servers, while "pick_first" sends them all to the first
+// server that it can reach.
+func loadBalancingPolicy() (string, error) {
+	switch policy := os.Getenv("SERVER_LB_POLICY"); policy {
+	case "":
+		return "round_robin", nil
+	case "round_robin", "pick_first":
+		return policy, nil
+	default:
+		return "", fmt.Errorf("SERVER_LB_POLICY must be round_robin or pick_first, got %q", policy)
+	}
+}
+
+// peerUnaryInterceptor records the address of the server that the load
+// balancer picked for the call in the rpc.peer.address attribute of the span
+// of ctx, such as the span of the HTTP request, so that the traces show how
+// the requests are spread over the servers. The span of the call itself has
+// it in server.address.
+func peerUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var p peer.Peer
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+	if p.Addr != nil {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Key("rpc.peer.address").String(p.Addr.String()))
+	}
+	return err
+}
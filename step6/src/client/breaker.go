@@ -0,0 +1,261 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerMinRequests = 10
+	defaultBreakerCooldown    = 5 * time.Second
+)
+
+// breakerState is the state of a circuitBreaker, recorded as the value of the
+// shakesapp.client.breaker.state gauge.
+type breakerState int64
+
+const (
+	// breakerClosed lets the calls through and counts their failures.
+	breakerClosed breakerState = iota
+	// breakerHalfOpen lets a single probe through after the cooldown.
+	breakerHalfOpen
+	// breakerOpen rejects the calls until the cooldown has passed.
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+// breakerOpenError is returned for the calls rejected by an open breaker.
+type breakerOpenError struct {
+	retryAfter time.Duration
+}
+
+func (e *breakerOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open, retry after %v", e.retryAfter)
+}
+
+// circuitBreaker stops calling the server while most of the calls of the last
+// window fail, so that a broken server isn't hammered by the retries of the
+// loadgen and the requests fail fast. After the cooldown, a single probe is
+// let through: it closes the breaker when it succeeds, and opens it for
+// another cooldown when it fails.
+type circuitBreaker struct {
+	errorRate   float64
+	minRequests int
+	cooldown    time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	openedAt time.Time
+	probing  bool
+	// buckets count the calls of the window, one bucket per second.
+	buckets []breakerBucket
+
+	rejected metric.Int64Counter
+}
+
+type breakerBucket struct {
+	second    int64
+	successes int
+	failures  int
+}
+
+// newBreakerInterceptor returns the interceptor that guards the calls to the
+// server with a circuit breaker when BREAKER_ERROR_RATE is set. The breaker
+// opens when at least BREAKER_MIN_REQUESTS calls (10) were made in the last
+// BREAKER_WINDOW (10s), and that rate of them failed. It stays open for
+// BREAKER_COOLDOWN (5s). It returns nil when BREAKER_ERROR_RATE is not set.
+func newBreakerInterceptor() (grpc.UnaryClientInterceptor, error) {
+	v := os.Getenv("BREAKER_ERROR_RATE")
+	if v == "" {
+		return nil, nil
+	}
+	errorRate, err := strconv.ParseFloat(v, 64)
+	if err != nil || errorRate <= 0 || errorRate > 1 {
+		return nil, fmt.Errorf("BREAKER_ERROR_RATE must be in (0, 1], got %q", v)
+	}
+	b := &circuitBreaker{
+		errorRate:   errorRate,
+		minRequests: defaultBreakerMinRequests,
+		cooldown:    defaultBreakerCooldown,
+	}
+	if v := os.Getenv("BREAKER_MIN_REQUESTS"); v != "" {
+		if b.minRequests, err = strconv.Atoi(v); err != nil || b.minRequests <= 0 {
+			return nil, fmt.Errorf("BREAKER_MIN_REQUESTS must be a positive integer, got %q", v)
+		}
+	}
+	window := defaultBreakerWindow
+	for env, d := range map[string]*time.Duration{
+		"BREAKER_WINDOW":   &window,
+		"BREAKER_COOLDOWN": &b.cooldown,
+	} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed < time.Second {
+				return nil, fmt.Errorf("%s must be a duration of at least 1s, got %q", env, v)
+			}
+			*d = parsed
+		}
+	}
+	b.buckets = make([]breakerBucket, int(window/time.Second))
+
+	meter := otel.Meter("client")
+	if b.rejected, err = meter.Int64Counter("shakesapp.client.breaker.rejected",
+		metric.WithDescription("Number of calls to the server rejected by the open circuit breaker."),
+		metric.WithUnit("{call}")); err != nil {
+		return nil, err
+	}
+	if _, err := meter.Int64ObservableGauge("shakesapp.client.breaker.state",
+		metric.WithDescription("State of the circuit breaker: 0 closed, 1 half-open, 2 open."),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			o.Observe(int64(b.state))
+			return nil
+		})); err != nil {
+		return nil, err
+	}
+	return b.intercept, nil
+}
+
+func (b *circuitBreaker) intercept(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	// the readiness check must see the health of the server, not the state
+	// of the breaker.
+	if strings.HasPrefix(method, healthMethodPrefix) {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	probe, err := b.allow(time.Now())
+	if err != nil {
+		b.rejected.Add(ctx, 1)
+		trace.SpanFromContext(ctx).AddEvent("circuit breaker open", trace.WithAttributes(
+			attribute.Key("rpc.method").String(method),
+		))
+		return err
+	}
+	err = invoker(ctx, method, req, reply, cc, opts...)
+	b.done(time.Now(), probe, serverFailure(err))
+	return err
+}
+
+// allow reports whether a call can be made at now, and whether it is the
+// probe of a half-open breaker.
+func (b *circuitBreaker) allow(now time.Time) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if elapsed := now.Sub(b.openedAt); elapsed < b.cooldown {
+			return false, &breakerOpenError{retryAfter: b.cooldown - elapsed}
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true, nil
+	case breakerHalfOpen:
+		if b.probing {
+			return false, &breakerOpenError{retryAfter: time.Second}
+		}
+		b.probing = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// done records the outcome of a call that ended at now.
+func (b *circuitBreaker) done(now time.Time, probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+		if failed {
+			b.openedAt = now
+			b.setState(breakerOpen)
+			return
+		}
+		clear(b.buckets)
+		b.setState(breakerClosed)
+		return
+	}
+	if b.state != breakerClosed {
+		return
+	}
+	second := now.Unix()
+	bucket := &b.buckets[second%int64(len(b.buckets))]
+	if bucket.second != second {
+		*bucket = breakerBucket{second: second}
+	}
+	if failed {
+		bucket.failures++
+	} else {
+		bucket.successes++
+	}
+
+	var successes, failures int
+	for _, bucket := range b.buckets {
+		if second-bucket.second < int64(len(b.buckets)) {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	total := successes + failures
+	if total >= b.minRequests && float64(failures) >= b.errorRate*float64(total) {
+		b.openedAt = now
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state != state {
+		slog.Info("circuit breaker changed state", "from", b.state.String(), "to", state.String())
+	}
+	b.state = state
+}
+
+// serverFailure reports whether err means that the server is failing, as
+// opposed to a rejected request.
+func serverFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+	"opentelemetry-trace-codelab-go/internal/lru"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// defaultResponseCacheTTL is shorter than the TTL of the result cache of the
+// server, since the cache of the client isn't flushed when the corpus is
+// reloaded.
+const defaultResponseCacheTTL = time.Minute
+
+// responseCache is a size-bounded LRU cache of the responses of the server,
+// keyed by requestKey, so that the repeated queries of the loadgen are
+// answered without calling the server. The entries expire after a TTL. A nil
+// *responseCache caches nothing.
+type responseCache struct {
+	cache   *lru.Cache[string, *shakesapp.ShakespeareResponse]
+	lookups metric.Int64Counter
+}
+
+// newResponseCache returns a cache of RESPONSE_CACHE_SIZE entries that expire
+// after RESPONSE_CACHE_TTL, which defaults to 1m. It returns nil when
+// RESPONSE_CACHE_SIZE is not set, so that every request calls the server as
+// in the other steps of the codelab.
+func newResponseCache() (*responseCache, error) {
+	v := os.Getenv("RESPONSE_CACHE_SIZE")
+	if v == "" {
+		return nil, nil
+	}
+	size, err := strconv.Atoi(v)
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("RESPONSE_CACHE_SIZE must be a positive integer, got %q", v)
+	}
+	ttl := defaultResponseCacheTTL
+	if v := os.Getenv("RESPONSE_CACHE_TTL"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("RESPONSE_CACHE_TTL must be a positive duration, got %q", v)
+		}
+	}
+	lookups, err := otel.Meter("client").Int64Counter("shakesapp.client.response_cache.lookups",
+		metric.WithDescription("Number of lookups of the response cache, by hit."),
+		metric.WithUnit("{lookup}"))
+	if err != nil {
+		return nil, err
+	}
+	return &responseCache{
+		cache:   lru.New[string, *shakesapp.ShakespeareResponse](size, ttl),
+		lookups: lookups,
+	}, nil
+}
+
+// get returns the response cached for key, and records the lookup as a hit or
+// a miss. The returned response must not be modified.
+func (c *responseCache) get(ctx context.Context, key string) (*shakesapp.ShakespeareResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	resp, ok := c.cache.Get(key)
+	c.lookups.Add(ctx, 1, metric.WithAttributes(attribute.Key("hit").Bool(ok)))
+	return resp, ok
+}
+
+// add caches resp for key, and evicts the least recently used entry when the
+// cache is full.
+func (c *responseCache) add(key string, resp *shakesapp.ShakespeareResponse) {
+	if c == nil {
+		return
+	}
+	c.cache.Add(key, resp)
+}
+
+// requestKey returns a key that is equal for the requests that have the same
+// response: the query is lowercased unless req is case sensitive.
+func requestKey(req *shakesapp.ShakespeareRequest) string {
+	query := req.Query
+	if !req.CaseSensitive {
+		query = strings.ToLower(query)
+	}
+	return fmt.Sprintf("%s/%t/%s", req.MatchMode, req.CaseSensitive, query)
+}
@@ -0,0 +1,198 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// minCompressSize is the size of the smallest body that is compressed. The
+// smaller bodies, like most of the responses of /v1/query, would grow with the
+// gzip header.
+const minCompressSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// compress wraps h to compress the bodies of its responses with gzip when the
+// request has Accept-Encoding: gzip, such as the results of /v1/queries. The
+// size of the compressed body is recorded in the
+// http.response.compressed_size attribute of the span of the request, so it
+// must come after tracing in the chain of the route. The
+// Server-Sent Events and the responses that are already encoded are sent as
+// is.
+func compress(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.close(trace.SpanFromContext(r.Context()))
+		h.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether the Accept-Encoding header v lists gzip, or *,
+// with a non-zero quality.
+func acceptsGzip(v string) bool {
+	for _, coding := range strings.Split(v, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		if q == "q=0" || strings.HasPrefix(q, "q=0.") && strings.Trim(q[len("q=0."):], "0") == "" {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter holds the status and the beginning of the body until it
+// knows whether to compress the body: the body is compressed once it reaches
+// minCompressSize, and sent as is when it is shorter or when the response is
+// flushed before.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+	// compressed counts the bytes written by gz.
+	compressed int
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.decided || code < http.StatusOK {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	g.status = code
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+	if !g.compressible() {
+		g.sendPlain()
+		return g.ResponseWriter.Write(p)
+	}
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= minCompressSize {
+		if err := g.sendCompressed(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends the body written so far, so that streaming keeps working behind
+// compress.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		g.sendPlain()
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// write counts the compressed bytes written by gz.
+func (g *gzipResponseWriter) write(p []byte) (int, error) {
+	n, err := g.ResponseWriter.Write(p)
+	g.compressed += n
+	return n, err
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// compressible reports whether the response can be compressed given its
+// status and headers.
+func (g *gzipResponseWriter) compressible() bool {
+	h := g.Header()
+	if g.status == http.StatusNoContent || g.status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	return !strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+func (g *gzipResponseWriter) sendPlain() {
+	g.decided = true
+	g.ResponseWriter.WriteHeader(g.status)
+	if len(g.buf) > 0 {
+		g.ResponseWriter.Write(g.buf)
+		g.buf = nil
+	}
+}
+
+func (g *gzipResponseWriter) sendCompressed() error {
+	g.decided = true
+	h := g.Header()
+	if h.Get("Content-Type") == "" {
+		// sniff the type from the plain body rather than from the compressed
+		// one.
+		h.Set("Content-Type", http.DetectContentType(g.buf))
+	}
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	g.ResponseWriter.WriteHeader(g.status)
+	g.gz = gzipWriters.Get().(*gzip.Writer)
+	g.gz.Reset(writerFunc(g.write))
+	_, err := g.gz.Write(g.buf)
+	g.buf = nil
+	return err
+}
+
+// close sends the rest of the body, and records its compressed size in span.
+func (g *gzipResponseWriter) close(span trace.Span) {
+	if !g.decided {
+		g.sendPlain()
+		return
+	}
+	if g.gz == nil {
+		return
+	}
+	g.gz.Close()
+	g.gz.Reset(io.Discard)
+	gzipWriters.Put(g.gz)
+	span.SetAttributes(attribute.Key("http.response.compressed_size").Int(g.compressed))
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	corsAllowedMethods = "GET, POST"
+	// corsAllowedHeaders lets the browsers send the trace context of the
+	// pages, so that their spans are the parents of the spans of the client.
+	corsAllowedHeaders = "Content-Type, traceparent, tracestate, baggage, X-Request-ID"
+	corsExposedHeaders = "traceresponse, Retry-After, X-Request-ID"
+	corsMaxAge         = "600"
+)
+
+// corsPolicy lets the pages of other origins call the API of the client from
+// a browser, e.g. a dashboard or the UI served from elsewhere. A nil
+// *corsPolicy allows the same origin only.
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+}
+
+// newCORSPolicy returns the policy that allows the origins listed in
+// CORS_ALLOWED_ORIGINS, separated by commas, such as
+// "https://dashboard.example.com,http://localhost:3000", or any origin for
+// "*". It returns nil when CORS_ALLOWED_ORIGINS is not set.
+func newCORSPolicy() (*corsPolicy, error) {
+	v := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if v == "" {
+		return nil, nil
+	}
+	p := &corsPolicy{origins: map[string]bool{}}
+	for _, origin := range strings.Split(v, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("CORS_ALLOWED_ORIGINS must be * or origins such as https://example.com, got %q", origin)
+		}
+		p.origins[u.Scheme+"://"+u.Host] = true
+	}
+	return p, nil
+}
+
+// wrap returns a handler that adds the CORS headers to the responses of h to
+// the allowed origins, and answers their preflight requests.
+func (p *corsPolicy) wrap(h http.Handler) http.Handler {
+	if p == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !p.allowed(origin) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if p.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	return p.anyOrigin || p.origins[origin]
+}
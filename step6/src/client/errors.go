@@ -0,0 +1,120 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusClientClosedRequest is the non-standard status of the requests whose
+// client went away before the response was written.
+const statusClientClosedRequest = 499
+
+// errorResponse is the body of the error responses of the client:
+//
+//	{"error": {"code": 400, "message": "unknown match_mode: foo"}, "request_id": "4bf92f3577b34da6a3ce929d0e0e4736"}
+//
+// code repeats the HTTP status of the response.
+type errorResponse struct {
+	Error     errorDetail `json:"error"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+type errorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError logs message msg and writes it to w with the HTTP status code.
+func writeError(ctx context.Context, w http.ResponseWriter, code int, msg string) {
+	slog.ErrorContext(ctx, msg, "code", code)
+	body, err := json.Marshal(errorResponse{
+		Error:     errorDetail{Code: code, Message: msg},
+		RequestID: telemetry.RequestIDFromContext(ctx),
+	})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// writeRPCError writes the error of a call to method of the server, with the
+// HTTP status of its gRPC code. When the circuit breaker rejected the call,
+// the response is a 503 with a Retry-After header, so that the loadgen backs
+// off. When the call didn't complete within the upstream timeout, the response
+// is a 504.
+func writeRPCError(ctx context.Context, w http.ResponseWriter, method string, err error) {
+	var open *breakerOpenError
+	if errors.As(err, &open) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.retryAfter.Seconds()))))
+	}
+	writeError(ctx, w, rpcStatus(err), fmt.Sprintf("error calling %s: %v", method, err))
+}
+
+// rpcStatus returns the HTTP status of the error of a call to the server.
+func rpcStatus(err error) int {
+	var open *breakerOpenError
+	if errors.As(err, &open) {
+		return http.StatusServiceUnavailable
+	}
+	return httpStatus(status.Code(err))
+}
+
+// httpStatus maps the gRPC code of a failed call to the server to the HTTP
+// status of the response of the client. The errors of the requests themselves
+// keep their 4xx status, while the failures of the server are reported as
+// 502, since the client is a gateway to it.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return statusClientClosedRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
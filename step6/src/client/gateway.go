@@ -0,0 +1,53 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"google.golang.org/grpc"
+)
+
+// newGateway returns the gRPC-gateway generated from shakesapp.proto, which
+// serves the RPCs of the server under /gateway/ with the HTTP rules of
+// shakesapp_gateway.yaml, and calls the server over conn. It is wrapped in
+// middlewares, inside its span. It returns nil unless GATEWAY is true.
+//
+// Unlike the handlers of /v1/, the gateway doesn't marshal the responses by
+// hand: they are the messages of the server in the JSON mapping of proto3.
+// The calls go through the interceptors of conn, so that their spans are
+// children of the span of the HTTP request, like the calls of the handlers.
+func newGateway(ctx context.Context, conn *grpc.ClientConn, middlewares Chain) (http.Handler, error) {
+	enabled, _ := strconv.ParseBool(os.Getenv("GATEWAY"))
+	if !enabled {
+		return nil, nil
+	}
+	mux := runtime.NewServeMux()
+	if err := shakesapp.RegisterShakespeareServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return NewChain(tracing("client.gateway", otelhttp.WithSpanNameFormatter(
+		func(operation string, r *http.Request) string {
+			return operation + " " + r.URL.Path
+		},
+	))).Use(middlewares...).Then(mux), nil
+}
@@ -16,4 +16,7 @@
 out=./shakesapp
 protodir=../../proto
 
-protoc --go_out="${out}" --go-grpc_out="${out}" -I "${protodir}" "${protodir}/shakesapp.proto"
\ No newline at end of file
+protoc --go_out="${out}" --go-grpc_out="${out}" \
+  --grpc-gateway_out="${out}" \
+  --grpc-gateway_opt=grpc_api_configuration="${protodir}/shakesapp_gateway.yaml" \
+  -I "${protodir}" "${protodir}/shakesapp.proto"
\ No newline at end of file
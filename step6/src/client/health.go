@@ -0,0 +1,87 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// healthMethodPrefix is the prefix of the methods of the health service
+	// of the server.
+	healthMethodPrefix = "/grpc.health.v1.Health/"
+
+	// healthCheckTimeout is shorter than the timeout of the readiness probe,
+	// so that the probe gets an answer when the server doesn't.
+	healthCheckTimeout = 900 * time.Millisecond
+)
+
+// readiness is the body of the responses of /readyz: the state of the
+// connection to the server, and the health of ShakespeareService as reported
+// by the server, or the error of the health check.
+//
+//	{"connection": "READY", "server": "SERVING"}
+type readiness struct {
+	Connection string `json:"connection"`
+	Server     string `json:"server"`
+	Error      string `json:"error,omitempty"`
+}
+
+// healthz is the liveness check handler. Unlike the readiness check, it
+// doesn't depend on the server, so that the pod isn't restarted while the
+// server is down.
+func (cs *clientService) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+// readyz is the readiness check handler. It calls the Check method of the
+// health service of the server for ShakespeareService, which the server
+// reports as SERVING once it can read the corpus, and fails unless the server
+// is serving, so that Kubernetes stops sending traffic to a client whose
+// server is down. The client starts before the server during a rolling
+// deploy: it is only ready once the server is.
+func (cs *clientService) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	cli := healthpb.NewHealthClient(cs.serverSvcConn)
+	// fail right away when the server can't be reached, rather than wait
+	// for the connection like the other calls.
+	resp, err := cli.Check(ctx, &healthpb.HealthCheckRequest{
+		Service: shakesapp.ShakespeareService_ServiceDesc.ServiceName,
+	}, grpc.WaitForReady(false))
+	ready := readiness{
+		Connection: cs.serverSvcConn.GetState().String(),
+		Server:     resp.GetStatus().String(),
+	}
+	code := http.StatusOK
+	if err != nil {
+		ready.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	} else if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		code = http.StatusServiceUnavailable
+	}
+	body, _ := json.Marshal(ready)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
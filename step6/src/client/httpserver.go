@@ -0,0 +1,96 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 10 * time.Second
+	// defaultWriteTimeout leaves time for the server to read the whole corpus
+	// from Cloud Storage.
+	defaultWriteTimeout   = 60 * time.Second
+	defaultIdleTimeout    = 120 * time.Second
+	defaultMaxHeaderBytes = 64 << 10
+)
+
+// newHTTPServer returns the HTTP server of the client on addr. Its timeouts
+// are read from HTTP_READ_HEADER_TIMEOUT, HTTP_READ_TIMEOUT,
+// HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT, which are durations such as "5s",
+// and the size of the request headers is bounded by HTTP_MAX_HEADER_BYTES, so
+// that slow or oversized requests can't hold the connections of the client.
+func newHTTPServer(addr string, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+	}
+	for env, d := range map[string]*time.Duration{
+		"HTTP_READ_HEADER_TIMEOUT": &srv.ReadHeaderTimeout,
+		"HTTP_READ_TIMEOUT":        &srv.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT":       &srv.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        &srv.IdleTimeout,
+	} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("%s must be a positive duration, got %q", env, v)
+			}
+			*d = parsed
+		}
+	}
+	if v := os.Getenv("HTTP_MAX_HEADER_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("HTTP_MAX_HEADER_BYTES must be a positive integer, got %q", v)
+		}
+		srv.MaxHeaderBytes = n
+	}
+	return srv, nil
+}
+
+// newActiveRequests returns the middleware that counts the requests that the
+// handler is handling in the http.server.active_requests metric, which the
+// otelhttp handlers don't record.
+func newActiveRequests() (Middleware, error) {
+	active, err := otel.Meter("client").Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs := metric.WithAttributes(attribute.Key("http.request.method").String(r.Method))
+			active.Add(r.Context(), 1, attrs)
+			defer active.Add(r.Context(), -1, attrs)
+			h.ServeHTTP(w, r)
+		})
+	}, nil
+}
@@ -18,34 +18,53 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"opentelemetry-trace-codelab-go/client/shakesapp"
+	"opentelemetry-trace-codelab-go/internal/telemetry"
 
-	cloudtrace "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 const (
+	serviceName    = "client"
+	serviceVersion = "1.0.0"
+
 	listenPort = "8080"
+
+	// defaultUpstreamTimeout is shorter than defaultWriteTimeout, so that the
+	// client can still answer with a 504.
+	defaultUpstreamTimeout = 30 * time.Second
 )
 
 type clientService struct {
 	serverSvcAddr string
 	serverSvcConn *grpc.ClientConn
+	// upstreamTimeout bounds the calls to the server, retries included.
+	upstreamTimeout time.Duration
+	// responses holds the recent responses of the server, or is nil.
+	responses *responseCache
+	// queries rejects the invalid queries before they reach the server.
+	queries queryValidator
+	// middlewares wrap the handlers of the routes of the API, inside their
+	// span.
+	middlewares Chain
 }
 
 func NewClientService() *clientService {
@@ -53,106 +72,379 @@ func NewClientService() *clientService {
 }
 
 // handler accepts HTTP requests from the loadgen and pass the query down to the server.
+// The optional case_sensitive and match_mode (regex, literal or whole_word)
+// parameters control how the server matches the query. It serves /v1/query and
+// its alias /, and answers with a queryResponse.
 //
 // TODO: instrument this method to trace the request down to the server.
 func (cs *clientService) handler(w http.ResponseWriter, r *http.Request) {
-	// NOTE: do not pass the raw query in produxtion systems.
-	rawQuery := r.URL.Query().Get("q")
-	query, err := url.QueryUnescape(rawQuery)
+	req, err := cs.parseQuery(r)
 	if err != nil {
-		writeError(w, fmt.Sprintf("can't unescape the query: %s", rawQuery))
+		writeError(r.Context(), w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	ctx := r.Context()
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := context.WithTimeout(ctx, cs.upstreamTimeout)
 	defer cancel()
 	// step1. instrument trace
+	// the span of the route is ended by otelhttp, after the middlewares of
+	// the chain have recorded the response on it.
 	span := trace.SpanFromContext(ctx)
-	defer span.End()
 	// step1. end instrument
 
-	cli := shakesapp.NewShakespeareServiceClient(cs.serverSvcConn)
-	resp, err := cli.GetMatchCount(ctx, &shakesapp.ShakespeareRequest{
-		Query: query,
-	})
+	start := time.Now()
+	resp, hit, err := cs.matchCount(ctx, req)
+	cs.recordMatchCount(span, req, time.Since(start), hit, err)
 	if err != nil {
-		writeError(w, fmt.Sprintf("error calling GetMatchCount: %v", err))
+		writeRPCError(ctx, w, "GetMatchCount", err)
 		return
 	}
-	ret, err := json.Marshal(resp)
+	ret, err := json.Marshal(queryResponse{
+		Query:         req.Query,
+		CaseSensitive: req.CaseSensitive,
+		MatchMode:     req.MatchMode.String(),
+		MatchCount:    resp.MatchCount,
+		Timing: queryTiming{
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Cached:     hit,
+		},
+		RequestID: telemetry.RequestIDFromContext(ctx),
+	})
 	if err != nil {
-		writeError(w, fmt.Sprintf("error marshalling data: %v", err))
+		writeError(ctx, w, http.StatusInternalServerError, fmt.Sprintf("error marshalling data: %v", err))
 		return
 	}
 	// step1. add span specific attribute
 	span.SetAttributes(attribute.Key("matched").Int64(resp.MatchCount))
 	// step1. end adding attribute
-	log.Println(string(ret))
+	span.SetAttributes(attribute.Key("http.response.body.size").Int(len(ret)))
+	slog.InfoContext(ctx, "matched query", "match_count", resp.MatchCount)
+	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(ret); err != nil {
-		writeError(w, fmt.Sprintf("error on writing response: %v", err))
-		return
+		// the status line is already sent.
+		slog.ErrorContext(ctx, "error on writing response", "error", err)
 	}
 }
 
-// health is the health check handler.
-func (cs *clientService) health(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+// recordMatchCount records on span the length of the query of req, in
+// characters, and the time d taken to get its count, so that the spans can be
+// grouped and filtered by these attributes in Cloud Trace. It also records
+// whether the count came from the response cache when the cache is enabled,
+// and the gRPC status code of the call to the server when one was made.
+func (cs *clientService) recordMatchCount(span trace.Span, req *shakesapp.ShakespeareRequest, d time.Duration, hit bool, err error) {
+	span.SetAttributes(
+		attribute.Key("query.length").Int(utf8.RuneCountInString(req.Query)),
+		attribute.Key("upstream.duration_ms").Float64(float64(d.Microseconds())/1000),
+	)
+	if cs.responses != nil {
+		span.SetAttributes(attribute.Key("response_cache.hit").Bool(hit))
+	}
+	// the errors of the breaker aren't gRPC statuses: the call wasn't made.
+	if s, ok := status.FromError(err); ok && !hit {
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(s.Code())))
+	}
+}
+
+// parseQuery returns the request to the server for the q, case_sensitive and
+// match_mode parameters of r, or the reason why they are invalid.
+func (cs *clientService) parseQuery(r *http.Request) (*shakesapp.ShakespeareRequest, error) {
+	// NOTE: do not pass the raw query in produxtion systems.
+	rawQuery := r.URL.Query().Get("q")
+	query, err := url.QueryUnescape(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("can't unescape the query: %s", rawQuery)
+	}
+
+	caseSensitive := false
+	if v := r.URL.Query().Get("case_sensitive"); v != "" {
+		caseSensitive, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse case_sensitive: %s", v)
+		}
+	}
+	matchMode, err := parseMatchMode(r.URL.Query().Get("match_mode"))
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.queries.validate(query, matchMode); err != nil {
+		return nil, err
+	}
+	return &shakesapp.ShakespeareRequest{
+		Query:         query,
+		CaseSensitive: caseSensitive,
+		MatchMode:     matchMode,
+	}, nil
+}
+
+// matchCount returns the response of the server to req, and whether it came
+// from the response cache instead of the server.
+func (cs *clientService) matchCount(ctx context.Context, req *shakesapp.ShakespeareRequest) (*shakesapp.ShakespeareResponse, bool, error) {
+	key := requestKey(req)
+	if resp, ok := cs.responses.get(ctx, key); ok {
+		return resp, true, nil
+	}
+	cli := shakesapp.NewShakespeareServiceClient(cs.serverSvcConn)
+	resp, err := cli.GetMatchCount(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	cs.responses.add(key, resp)
+	return resp, false, nil
+}
+
+// parseMatchMode returns the match mode named v, case-insensitively. An empty
+// v is the default REGEX mode.
+func parseMatchMode(v string) (shakesapp.MatchMode, error) {
+	if v == "" {
+		return shakesapp.MatchMode_REGEX, nil
+	}
+	m, ok := shakesapp.MatchMode_value[strings.ToUpper(v)]
+	if !ok {
+		return 0, fmt.Errorf("unknown match_mode: %s", v)
+	}
+	return shakesapp.MatchMode(m), nil
+}
+
+// batchHandler accepts HTTP requests with several q parameters and passes
+// them down to the server in a single GetMatchCounts request, which counts
+// all of them in one pass over the corpus. The queries are matched literally.
+func (cs *clientService) batchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), cs.upstreamTimeout)
+	defer cancel()
+	queries := r.URL.Query()["q"]
+	caseSensitive := false
+	if v := r.URL.Query().Get("case_sensitive"); v != "" {
+		var err error
+		caseSensitive, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(ctx, w, http.StatusBadRequest, fmt.Sprintf("can't parse case_sensitive: %s", v))
+			return
+		}
+	}
+	for _, q := range queries {
+		if err := cs.queries.validate(q, shakesapp.MatchMode_LITERAL); err != nil {
+			writeError(ctx, w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	cli := shakesapp.NewShakespeareServiceClient(cs.serverSvcConn)
+	resp, err := cli.GetMatchCounts(ctx, &shakesapp.BatchShakespeareRequest{
+		Queries:       queries,
+		CaseSensitive: caseSensitive,
+	})
+	if err != nil {
+		writeRPCError(ctx, w, "GetMatchCounts", err)
+		return
+	}
+	ret, err := json.Marshal(resp)
+	if err != nil {
+		writeError(ctx, w, http.StatusInternalServerError, fmt.Sprintf("error marshalling data: %v", err))
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Key("queries").Int(len(queries)))
+	slog.InfoContext(ctx, "matched queries", "queries", len(queries))
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(ret); err != nil {
+		// the status line is already sent.
+		slog.ErrorContext(ctx, "error on writing response", "error", err)
+	}
 }
 
 // step1. add OpenTelemetry initialization function
 func initTracer() (*sdktrace.TracerProvider, error) {
-	// step3. replace stdout exporter with Cloud Trace exporter
-	// cloudtrace.New() finds the credentials to Cloud Trace automatically following the
-	// rules defined by golang.org/x/oauth2/google.findDefaultCredentailsWithParams.
-	// https://pkg.go.dev/golang.org/x/oauth2/google#FindDefaultCredentialsWithParams
-	exporter, err := cloudtrace.New()
-	// step3. end replacing exporter
+	exporter, err := telemetry.NewExporter(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	// for the demonstration, we use AlwaysSmaple sampler to take all spans.
-	// do not use this option in production.
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exporter),
-	)
+	// for the demonstration, NewSampler returns AlwaysSample sampler to take all
+	// spans unless OTEL_TRACES_SAMPLER is set.
+	sampler, err := telemetry.NewSampler()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := telemetry.NewSpanLimits()
+	if err != nil {
+		return nil, err
+	}
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	prop, err := telemetry.NewPropagator()
+	if err != nil {
+		return nil, err
+	}
+	batcher, err := telemetry.NewBatchSpanProcessor(exporter)
+	if err != nil {
+		return nil, err
+	}
+	// hash the raw queries before they are exported.
+	redaction, err := telemetry.NewRedactionProcessor(batcher)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithRawSpanLimits(limits),
+		// drop the spans of the kubelet probes before they are exported.
+		sdktrace.WithSpanProcessor(telemetry.NewHealthCheckFilter(redaction)),
+	}
+	zp, err := telemetry.NewZPages()
+	if err != nil {
+		return nil, err
+	}
+	if zp != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(zp))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTextMapPropagator(prop)
 	return tp, nil
 }
 
+// initMeter sets the global MeterProvider, which the otelhttp handler and the
+// otelgrpc stats handler use to record the metrics of the requests.
+func initMeter() (*sdkmetric.MeterProvider, error) {
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	mp, err := telemetry.NewMeterProvider(context.Background(), res)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetMeterProvider(mp)
+	return mp, nil
+}
+
+// initLogger creates the LoggerProvider that exports the log records of the
+// client next to its spans.
+func initLogger() (*sdklog.LoggerProvider, error) {
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return telemetry.NewLoggerProvider(context.Background(), res)
+}
+
 func main() {
+	slog.SetDefault(telemetry.NewLogger(serviceName, nil))
+	// size the Go runtime to the container before the resources are created,
+	// so that they carry its memory limit.
+	slog.Info("configured the Go runtime",
+		"gomaxprocs", telemetry.SetMaxProcs(),
+		"gomemlimit", telemetry.SetMemoryLimit(),
+	)
+
+	lp, err := initLogger()
+	if err != nil {
+		fatal("failed to initialize LoggerProvider", "error", err)
+	}
+	defer func() {
+		if err := lp.Shutdown(context.Background()); err != nil {
+			fatal("failed to shut down LoggerProvider", "error", err)
+		}
+	}()
+	slog.SetDefault(telemetry.NewLogger(serviceName, lp))
+
 	// step1. setup OpenTelemetry
 	tp, err := initTracer()
 	if err != nil {
-		log.Fatalf("failed to initialize TracerProvider: %v", err)
+		fatal("failed to initialize TracerProvider", "error", err)
 	}
 	defer func() {
 		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down TracerProvider: %v", err)
+			fatal("failed to shut down TracerProvider", "error", err)
 		}
 	}()
 	// step1. end setup
 
+	mp, err := initMeter()
+	if err != nil {
+		fatal("failed to initialize MeterProvider", "error", err)
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			fatal("failed to shut down MeterProvider", "error", err)
+		}
+	}()
+
 	ctx := context.Background()
 	svc := NewClientService()
 	mustMapEnv(&svc.serverSvcAddr, "SERVER_SVC_ADDR")
-	mustConnGRPC(ctx, &svc.serverSvcConn, svc.serverSvcAddr)
+	timeout, err := upstreamTimeout()
+	if err != nil {
+		fatal("failed to configure the upstream timeout", "error", err)
+	}
+	svc.upstreamTimeout = timeout
+	if svc.responses, err = newResponseCache(); err != nil {
+		fatal("failed to configure the response cache", "error", err)
+	}
+	if svc.queries, err = newQueryValidator(); err != nil {
+		fatal("failed to configure the query validation", "error", err)
+	}
+	mustConnGRPC(&svc.serverSvcConn, svc.serverSvcAddr)
+	recovery, err := newRecovery()
+	if err != nil {
+		fatal("failed to configure panic recovery", "error", err)
+	}
+	// the middlewares run in order inside the span of the route, so that the
+	// access log and the recovered panics are recorded on it, and the
+	// compression sees the final body. The metrics of the routes are recorded
+	// by the tracing middleware of svc.route, which comes before them. Auth
+	// isn't part of the chain: the routes of the client are public, and its
+	// only credential is the bearer token of AUTH_TOKEN, which the connection
+	// to the server attaches to every RPC.
+	svc.middlewares = NewChain(tagRequestID, traceResponse, accessLog, recovery, compress)
 
 	// step1. change handler to intercept OpenTelemetry related headers
-	otelHandler := otelhttp.NewHandler(http.HandlerFunc(svc.handler), "client.handler")
-	http.Handle("/", otelHandler)
+	// svc.route wraps the handler in the otelhttp handler of tracing.
+	http.Handle("/", svc.route("client.handler", svc.handler))
 	// step1. end intercepter setting
-	http.HandleFunc("/_genki", svc.health)
+	http.Handle("/batch", svc.route("client.batchHandler", svc.batchHandler))
+	http.Handle("/v1/", http.StripPrefix("/v1", svc.apiV1()))
+	http.HandleFunc("/openapi.json", openAPI)
+	http.HandleFunc("GET /ui", ui)
+	gateway, err := newGateway(ctx, svc.serverSvcConn, svc.middlewares)
+	if err != nil {
+		fatal("failed to register the gRPC-gateway", "error", err)
+	}
+	if gateway != nil {
+		http.Handle("/gateway/", gateway)
+	}
+	http.HandleFunc("/healthz", svc.healthz)
+	http.HandleFunc("/readyz", svc.readyz)
+	// the liveness check of the previous steps.
+	http.HandleFunc("/_genki", svc.healthz)
+	if h := telemetry.MetricsHandler(); h != nil {
+		http.Handle("/metrics", h)
+	}
 
 	port := listenPort
 	if os.Getenv("CLIENT_PORT") != "" {
 		port = os.Getenv("CLIENT_PORT")
 	}
-	if err := http.ListenAndServe(fmt.Sprintf(":%v", port), nil); err != nil {
-		log.Fatalf("error listening HTTP server: %v", err)
+	cors, err := newCORSPolicy()
+	if err != nil {
+		fatal("failed to configure CORS", "error", err)
+	}
+	activeRequests, err := newActiveRequests()
+	if err != nil {
+		fatal("failed to create the metrics of the HTTP server", "error", err)
+	}
+	// the middlewares of every request, including the ones that don't match
+	// any route.
+	handler := NewChain(activeRequests, withRequestID, cors.wrap).Then(http.DefaultServeMux)
+	srv, err := newHTTPServer(fmt.Sprintf(":%v", port), handler)
+	if err != nil {
+		fatal("failed to configure the HTTP server", "error", err)
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		fatal("failed to serve HTTP", "error", err)
 	}
 }
 
@@ -160,32 +452,97 @@ func main() {
 func mustMapEnv(target *string, envKey string) {
 	v := os.Getenv(envKey)
 	if v == "" {
-		log.Fatalf("environment variable %q not set", envKey)
+		fatal("environment variable not set", "key", envKey)
 	}
 	*target = v
 }
 
-// Helper function for gRPC connections: Dial and create client once, reuse.
-func mustConnGRPC(ctx context.Context, conn **grpc.ClientConn, addr string) {
-	var err error
+// fatal logs msg with the key-value pairs in args as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// Helper function for gRPC connections: create client once, reuse.
+// The connection is made in the background and remade when it is lost, so
+// that the client starts even when the server isn't up yet.
+func mustConnGRPC(conn **grpc.ClientConn, addr string) {
+	creds, err := transportCredentials()
+	if err != nil {
+		fatal("failed to configure TLS", "error", err)
+	}
 	// step2. add gRPC interceptor
-	interceptorOpt := otelgrpc.WithTracerProvider(otel.GetTracerProvider())
-	*conn, err = grpc.DialContext(ctx, addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor(interceptorOpt)),
-		grpc.WithStreamInterceptor(otelgrpc.StreamClientInterceptor(interceptorOpt)),
-		grpc.WithTimeout(time.Second*3),
+	handlerOpt := otelgrpc.WithTracerProvider(otel.GetTracerProvider())
+	meterOpt := otelgrpc.WithMeterProvider(otel.GetMeterProvider())
+	attempts, err := newUpstreamAttempts()
+	if err != nil {
+		fatal("failed to configure retries", "error", err)
+	}
+	breaker, err := newBreakerInterceptor()
+	if err != nil {
+		fatal("failed to configure the circuit breaker", "error", err)
+	}
+	// the breaker sees the outcome of the retries of gRPC and of the hedged
+	// attempts, not of every attempt.
+	upstreamMetrics, err := newUpstreamMetricsInterceptor()
+	if err != nil {
+		fatal("failed to create the metrics of the calls to the server", "error", err)
+	}
+	bag := newBaggageInjector()
+	interceptors := []grpc.UnaryClientInterceptor{requestIDUnaryInterceptor, bag.unary}
+	if breaker != nil {
+		interceptors = append(interceptors, breaker)
+	}
+	// the calls rejected by the breaker don't reach the server.
+	interceptors = append(interceptors, upstreamMetrics)
+	if hedge := attempts.hedgingInterceptor(); hedge != nil {
+		interceptors = append(interceptors, hedge)
+	}
+	interceptors = append(interceptors, retryUnaryInterceptor, peerUnaryInterceptor)
+	policy, err := loadBalancingPolicy()
+	if err != nil {
+		fatal("failed to configure load balancing", "error", err)
+	}
+	// gRPC retries the calls with the retry policy of the service config, and
+	// retryStatsHandler records the retries on the span of the request.
+	sc, err := newServiceConfig(policy, attempts)
+	if err != nil {
+		fatal("failed to create the service config", "error", err)
+	}
+	target, opts := serverTarget(addr)
+	opts = append(opts,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(handlerOpt, meterOpt)),
+		grpc.WithStatsHandler(retryStatsHandler{}),
+		grpc.WithChainUnaryInterceptor(interceptors...),
+		grpc.WithChainStreamInterceptor(requestIDStreamInterceptor, bag.stream),
+		// the calls wait for the connection to the server until their
+		// deadline, instead of failing while the server starts.
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
+		grpc.WithDefaultServiceConfig(sc),
 	)
+	if token := os.Getenv("AUTH_TOKEN"); token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(token)))
+	}
+	*conn, err = grpc.NewClient(target, opts...)
 	// step2: end adding interceptor
 	if err != nil {
-		panic(fmt.Sprintf("Error %s grpc: failed to connect %s", err, addr))
+		fatal("failed to create the client of the server", "addr", addr, "error", err)
 	}
 }
 
-// writeError writes error message s to w.
-// This function is just for demo use and can't be used in production, because
-// it doesn't handle escaping double quote and new lines.
-func writeError(w io.Writer, s string) {
-	log.Println(s)
-	w.Write([]byte(`{"error": "` + s + `"}`))
+// upstreamTimeout reads the timeout of the calls to the server from
+// UPSTREAM_TIMEOUT_MS, in milliseconds. It defaults to
+// defaultUpstreamTimeout, so that a slow read of the corpus doesn't hold the
+// HTTP requests open for longer than the write timeout of the HTTP server.
+func upstreamTimeout() (time.Duration, error) {
+	v := os.Getenv("UPSTREAM_TIMEOUT_MS")
+	if v == "" {
+		return defaultUpstreamTimeout, nil
+	}
+	ms, err := strconv.Atoi(v)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("UPSTREAM_TIMEOUT_MS must be a positive integer, got %q", v)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
 }
@@ -0,0 +1,61 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// durationBuckets are the bucket boundaries, in seconds, of the latency
+// histograms, like the ones of the server. Each bucket keeps the trace ID of
+// a request that fell in it as an exemplar.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// newUpstreamMetricsInterceptor returns the interceptor that records the
+// duration of the calls to the server, such as GetMatchCount, in the
+// shakesapp.client.upstream.duration histogram by method and gRPC status
+// code. Unlike the rpc.client.duration metric of otelgrpc, which measures
+// every attempt, a call includes its retries and its hedged attempts, so that
+// the histogram shows the latency seen by the handlers of the client. The
+// health checks of /readyz are left out.
+func newUpstreamMetricsInterceptor() (grpc.UnaryClientInterceptor, error) {
+	duration, err := otel.Meter("client").Float64Histogram("shakesapp.client.upstream.duration",
+		metric.WithDescription("Duration of the calls to the server, retries included."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if strings.HasPrefix(method, healthMethodPrefix) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+			semconv.RPCMethodKey.String(method[strings.LastIndex(method, "/")+1:]),
+			semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))),
+		))
+		return err
+	}, nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a handler with a concern shared by several routes, such as
+// tracing or compression.
+type Middleware func(http.Handler) http.Handler
+
+// Chain is a list of middlewares. The first one is the outermost: it sees the
+// request first and the response last.
+type Chain []Middleware
+
+// NewChain returns the chain of the middlewares ms.
+func NewChain(ms ...Middleware) Chain {
+	return append(Chain(nil), ms...)
+}
+
+// Use returns a copy of c with the middlewares ms appended, which are inner to
+// the middlewares of c. c itself is left unchanged, so that several chains
+// can be derived from it.
+func (c Chain) Use(ms ...Middleware) Chain {
+	return append(c[:len(c):len(c)], ms...)
+}
+
+// Then returns h wrapped in the middlewares of c.
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// ThenFunc is Then for a handler function.
+func (c Chain) ThenFunc(h http.HandlerFunc) http.Handler {
+	return c.Then(h)
+}
+
+// tracing returns the middleware that wraps the handler in a span named
+// operation, which is the parent of the spans of the inner middlewares and of
+// the calls to the server. It also records the http.server.request.duration
+// and the sizes of the requests and the responses of the route in the
+// metrics of the client. It must come first in the chain of a route.
+func tracing(operation string, opts ...otelhttp.Option) Middleware {
+	opts = append([]otelhttp.Option{otelhttp.WithMeterProvider(otel.GetMeterProvider())}, opts...)
+	return func(h http.Handler) http.Handler {
+		return otelhttp.NewHandler(h, operation, opts...)
+	}
+}
+
+// traceResponse returns the trace context of the span of the request in the
+// traceresponse header of W3C Trace Context Level 2, so that the callers can
+// look up the trace of their requests.
+// https://www.w3.org/TR/trace-context-2/#traceresponse-header
+func traceResponse(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			w.Header().Set("traceresponse", fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags()))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// accessLog logs a line per request with its method, path, status, the size
+// of the response and its duration, like the access log of the server.
+func accessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		// the path of the request as sent, before http.StripPrefix.
+		path, _, _ := strings.Cut(r.RequestURI, "?")
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", path,
+			"status", rec.status,
+			"response_bytes", rec.bytes,
+			"duration_ms", float64(time.Since(start))/float64(time.Millisecond),
+		)
+	})
+}
+
+// newRecovery returns the middleware that turns a panic of the handler into a
+// 500 response, so that a bug in a handler fails the request instead of the
+// whole client. The stack trace of the panic is logged and recorded as an
+// exception event on the span of the request.
+func newRecovery() (Middleware, error) {
+	panics, err := otel.Meter("client").Int64Counter("shakesapp.client.panics",
+		metric.WithDescription("Number of requests whose handler panicked."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					// the handler aborts the response on purpose.
+					panic(p)
+				}
+				ctx := r.Context()
+				stack := string(debug.Stack())
+				slog.ErrorContext(ctx, "recovered from panic", "route", r.Pattern, "panic", fmt.Sprint(p), "stack", stack)
+				trace.SpanFromContext(ctx).AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+					semconv.ExceptionTypeKey.String(fmt.Sprintf("%T", p)),
+					semconv.ExceptionMessageKey.String(fmt.Sprint(p)),
+					semconv.ExceptionStacktraceKey.String(stack),
+				))
+				panics.Add(ctx, 1, metric.WithAttributes(attribute.Key("http.route").String(r.Pattern)))
+				if !rec.wroteHeader {
+					writeError(ctx, rec, http.StatusInternalServerError, fmt.Sprintf("panic: %v", p))
+				}
+			}()
+			h.ServeHTTP(rec, r)
+		})
+	}, nil
+}
+
+// responseRecorder records the status and the size of the response written
+// to the wrapped writer.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if !r.wroteHeader && code >= http.StatusOK {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// Flush keeps the streaming routes working behind the middlewares.
+func (r *responseRecorder) Flush() {
+	r.wroteHeader = true
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
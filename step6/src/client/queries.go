@@ -0,0 +1,172 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxQueries is the number of queries that a request of /v1/queries can
+	// hold, as many as a GetMatchCounts request.
+	maxQueries = 100
+	// maxQueriesBytes bounds the size of the body of a request of /v1/queries.
+	maxQueriesBytes = 64 << 10
+	// queriesConcurrency is the number of queries of a request of /v1/queries
+	// that are sent to the server at once.
+	queriesConcurrency = 8
+)
+
+// queryRequest is a query of the body of a request of /v1/queries:
+//
+//	[
+//	  {"query": "love"},
+//	  {"query": "to be", "case_sensitive": true, "match_mode": "literal"}
+//	]
+type queryRequest struct {
+	Query         string `json:"query"`
+	CaseSensitive bool   `json:"case_sensitive"`
+	MatchMode     string `json:"match_mode"`
+}
+
+// queryResult is the result of a query of a request of /v1/queries: either
+// the fields of a queryResponse, or the error of the query.
+type queryResult struct {
+	*queryResponse
+	Error *errorDetail `json:"error,omitempty"`
+}
+
+// queriesResponse is the body of the responses of /v1/queries. The results
+// are in the order of the queries of the request.
+type queriesResponse struct {
+	Results   []queryResult `json:"results"`
+	RequestID string        `json:"request_id"`
+}
+
+// queriesHandler accepts a JSON array of queryRequest and sends each of them
+// to the server in its own GetMatchCount request, concurrently. Unlike the
+// batch endpoint, the queries can each have their own match mode, and every
+// query has its own client.query span under the span of the HTTP request. The
+// response holds the result or the error of every query, so that a failed
+// query doesn't fail the others.
+func (cs *clientService) queriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), cs.upstreamTimeout)
+	defer cancel()
+
+	var reqs []queryRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueriesBytes)).Decode(&reqs); err != nil {
+		writeError(ctx, w, http.StatusBadRequest, fmt.Sprintf("can't parse the queries: %v", err))
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxQueries {
+		writeError(ctx, w, http.StatusBadRequest, fmt.Sprintf("a request must have between 1 and %d queries, got %d", maxQueries, len(reqs)))
+		return
+	}
+
+	results := make([]queryResult, len(reqs))
+	sem := make(chan struct{}, queriesConcurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = cs.query(ctx, i, req)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, res := range results {
+		if res.Error != nil {
+			failed++
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Key("queries").Int(len(reqs)),
+		attribute.Key("queries.failed").Int(failed),
+	)
+	ret, err := json.Marshal(queriesResponse{Results: results, RequestID: telemetry.RequestIDFromContext(ctx)})
+	if err != nil {
+		writeError(ctx, w, http.StatusInternalServerError, fmt.Sprintf("error marshalling data: %v", err))
+		return
+	}
+	slog.InfoContext(ctx, "matched queries", "queries", len(reqs), "failed", failed)
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(ret); err != nil {
+		// the status line is already sent.
+		slog.ErrorContext(ctx, "error on writing response", "error", err)
+	}
+}
+
+// query counts the matches of the index-th query of a request of /v1/queries
+// in a client.query span.
+func (cs *clientService) query(ctx context.Context, index int, q queryRequest) queryResult {
+	ctx, span := otel.Tracer("client").Start(ctx, "client.query", trace.WithAttributes(
+		attribute.Key("index").Int(index),
+	))
+	defer span.End()
+
+	fail := func(code int, err error) queryResult {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return queryResult{Error: &errorDetail{Code: code, Message: err.Error()}}
+	}
+	matchMode, err := parseMatchMode(q.MatchMode)
+	if err != nil {
+		return fail(http.StatusBadRequest, err)
+	}
+	if err := cs.queries.validate(q.Query, matchMode); err != nil {
+		return fail(http.StatusBadRequest, err)
+	}
+	start := time.Now()
+	resp, hit, err := cs.matchCount(ctx, &shakesapp.ShakespeareRequest{
+		Query:         q.Query,
+		CaseSensitive: q.CaseSensitive,
+		MatchMode:     matchMode,
+	})
+	if err != nil {
+		return fail(rpcStatus(err), fmt.Errorf("error calling GetMatchCount: %v", err))
+	}
+	span.SetAttributes(
+		attribute.Key("matched").Int64(resp.MatchCount),
+		attribute.Key("response_cache.hit").Bool(hit),
+	)
+	return queryResult{queryResponse: &queryResponse{
+		Query:         q.Query,
+		CaseSensitive: q.CaseSensitive,
+		MatchMode:     matchMode.String(),
+		MatchCount:    resp.MatchCount,
+		Timing: queryTiming{
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Cached:     hit,
+		},
+	}}
+}
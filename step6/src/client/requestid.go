@@ -0,0 +1,83 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// withRequestID wraps h to give every request an ID, which correlates the logs
+// and the spans of a request in the client and in the server even when its
+// trace isn't sampled. The ID is the X-Request-ID header of the request when
+// it is valid, or a new random ID otherwise. It is returned in the
+// X-Request-ID header of the response.
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(telemetry.RequestIDHeader)
+		if !telemetry.ValidRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(telemetry.RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(telemetry.ContextWithRequestID(r.Context(), id)))
+	})
+}
+
+// tagRequestID wraps h to record the request ID in the request.id attribute of
+// the span of the request. It must come after tracing in the chain of the
+// route, which starts the span.
+func tagRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := telemetry.RequestIDFromContext(r.Context()); id != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.Key("request.id").String(id))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// newRequestID returns a random ID of 32 hex digits.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestIDUnaryInterceptor sends the request ID of ctx to the server in the
+// x-request-id metadata of the call.
+func requestIDUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+}
+
+// requestIDStreamInterceptor is the stream counterpart of
+// requestIDUnaryInterceptor.
+func requestIDStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+}
+
+func outgoingRequestID(ctx context.Context) context.Context {
+	if id := telemetry.RequestIDFromContext(ctx); id != "" {
+		return metadata.AppendToOutgoingContext(ctx, telemetry.RequestIDMetadata, id)
+	}
+	return ctx
+}
@@ -0,0 +1,248 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultUpstreamMaxAttempts    = 3
+	defaultUpstreamInitialBackoff = 100 * time.Millisecond
+	defaultUpstreamMaxBackoff     = time.Second
+
+	// maxUpstreamAttempts is the largest number of attempts that gRPC makes,
+	// whatever the service config asks for.
+	maxUpstreamAttempts = 5
+)
+
+// upstreamAttempts is the policy of the attempts of the calls to the server:
+// either gRPC retries the failed calls, or the client hedges the slow ones.
+type upstreamAttempts struct {
+	maxAttempts int
+	initial     time.Duration
+	max         time.Duration
+	// hedgingDelay is the delay after which a call that hasn't answered yet
+	// is sent again, or 0 to retry the failed calls instead.
+	hedgingDelay time.Duration
+}
+
+// newUpstreamAttempts reads the policy from UPSTREAM_MAX_ATTEMPTS,
+// UPSTREAM_INITIAL_BACKOFF, UPSTREAM_MAX_BACKOFF and UPSTREAM_HEDGING_DELAY.
+// The backoffs and the delay are durations such as "100ms". Set
+// UPSTREAM_MAX_ATTEMPTS to 1 to disable the retries and the hedging.
+func newUpstreamAttempts() (upstreamAttempts, error) {
+	a := upstreamAttempts{
+		maxAttempts: defaultUpstreamMaxAttempts,
+		initial:     defaultUpstreamInitialBackoff,
+		max:         defaultUpstreamMaxBackoff,
+	}
+	if v := os.Getenv("UPSTREAM_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxUpstreamAttempts {
+			return a, fmt.Errorf("UPSTREAM_MAX_ATTEMPTS must be an integer between 1 and %d, got %q", maxUpstreamAttempts, v)
+		}
+		a.maxAttempts = n
+	}
+	for env, d := range map[string]*time.Duration{
+		"UPSTREAM_INITIAL_BACKOFF": &a.initial,
+		"UPSTREAM_MAX_BACKOFF":     &a.max,
+		"UPSTREAM_HEDGING_DELAY":   &a.hedgingDelay,
+	} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return a, fmt.Errorf("%s must be a positive duration, got %q", env, v)
+			}
+			*d = parsed
+		}
+	}
+	return a, nil
+}
+
+// methodConfig returns the method config of ShakespeareService, which makes
+// gRPC retry the calls that fail with UNAVAILABLE or DEADLINE_EXCEEDED, e.g.
+// while the server pods restart. A call isn't retried once the deadline of the
+// request itself has passed. It returns nil when the calls are hedged or make
+// a single attempt.
+func (a upstreamAttempts) methodConfig() []methodConfig {
+	if a.maxAttempts == 1 || a.hedgingDelay > 0 {
+		return nil
+	}
+	return []methodConfig{{
+		Name: []methodName{{Service: shakesapp.ShakespeareService_ServiceDesc.ServiceName}},
+		RetryPolicy: &retryPolicy{
+			MaxAttempts:          a.maxAttempts,
+			InitialBackoff:       protoDuration(a.initial),
+			MaxBackoff:           protoDuration(a.max),
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE", "DEADLINE_EXCEEDED"},
+		},
+	}}
+}
+
+// protoDuration formats d as a duration of the proto3 JSON mapping.
+func protoDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// callAttemptsKey is the context key of the *callAttempts of a call.
+type callAttemptsKey struct{}
+
+// callAttempts counts the attempts that gRPC makes for a call to the server.
+type callAttempts struct {
+	span   trace.Span
+	method string
+
+	mu       sync.Mutex
+	attempts int
+	lastCode codes.Code
+}
+
+// retryUnaryInterceptor lets retryStatsHandler count the attempts of the call,
+// which gRPC retries out of the sight of the interceptors. It comes after the
+// hedging interceptor, so that every hedged attempt is counted on its own.
+func retryUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = context.WithValue(ctx, callAttemptsKey{}, &callAttempts{
+		span:   trace.SpanFromContext(ctx),
+		method: method,
+	})
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// retryStatsHandler records the retries of the calls made by gRPC as "retry"
+// events of the span of the call's context, such as the span of the HTTP
+// request, with the status code of the failed attempt. gRPC calls the stats
+// handlers for every attempt, each with its own span from otelgrpc.
+type retryStatsHandler struct{}
+
+func (retryStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (retryStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	a, ok := ctx.Value(callAttemptsKey{}).(*callAttempts)
+	if !ok {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch s := s.(type) {
+	case *stats.Begin:
+		a.attempts++
+		if a.attempts > 1 {
+			a.span.AddEvent("retry", trace.WithAttributes(
+				attribute.Key("rpc.method").String(a.method),
+				attribute.Key("retry.attempt").Int(a.attempts),
+				attribute.Key("retry.transparent").Bool(s.IsTransparentRetryAttempt),
+				attribute.Key("rpc.grpc.status_code").Int(int(a.lastCode)),
+			))
+		}
+	case *stats.End:
+		a.lastCode = status.Code(s.Error)
+	}
+}
+
+func (retryStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (retryStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// hedgingInterceptor returns the interceptor that hedges the unary calls, or
+// nil unless UPSTREAM_HEDGING_DELAY is set. gRPC-Go doesn't implement the
+// hedgingPolicy of the service config, so the client hedges the calls itself.
+func (a upstreamAttempts) hedgingInterceptor() grpc.UnaryClientInterceptor {
+	if a.maxAttempts == 1 || a.hedgingDelay == 0 {
+		return nil
+	}
+	return a.hedge
+}
+
+// hedge sends the call again every hedgingDelay while no attempt has
+// answered, up to maxAttempts attempts, and right away when an attempt fails
+// with UNAVAILABLE. The first answer wins and cancels the other attempts, so
+// that a slow server pod doesn't slow down the request. Every attempt has its
+// own span, and the hedged attempts are recorded as "hedge" events of the
+// span of ctx. GetMatchCount doesn't change anything on the server, so it is
+// safe to call several times.
+func (a upstreamAttempts) hedge(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		reply proto.Message
+		err   error
+	}
+	results := make(chan result, a.maxAttempts)
+	sent, pending := 0, 0
+	send := func() {
+		sent++
+		pending++
+		if sent > 1 {
+			trace.SpanFromContext(ctx).AddEvent("hedge", trace.WithAttributes(
+				attribute.Key("rpc.method").String(method),
+				attribute.Key("hedge.attempt").Int(sent),
+			))
+		}
+		go func() {
+			r := reply.(proto.Message).ProtoReflect().New().Interface()
+			err := invoker(ctx, method, req, r, cc, opts...)
+			results <- result{r, err}
+		}()
+	}
+	timer := time.NewTimer(a.hedgingDelay)
+	defer timer.Stop()
+	send()
+	var err error
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				proto.Merge(reply.(proto.Message), res.reply)
+				return nil
+			}
+			err = res.err
+			if status.Code(err) != codes.Unavailable {
+				return err
+			}
+			if pending == 0 && sent < a.maxAttempts && ctx.Err() == nil {
+				send()
+				timer.Reset(a.hedgingDelay)
+			}
+		case <-timer.C:
+			if sent < a.maxAttempts {
+				send()
+				timer.Reset(a.hedgingDelay)
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "encoding/json"
+
+// serviceConfig is the default service config of the connection to the
+// server, in the JSON format of gRPC.
+// https://github.com/grpc/grpc/blob/master/doc/service_config.md
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]struct{} `json:"loadBalancingConfig"`
+	MethodConfig        []methodConfig        `json:"methodConfig,omitempty"`
+	RetryThrottling     *retryThrottling      `json:"retryThrottling,omitempty"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+// methodName selects the methods of a service, or all of them when Method is
+// empty.
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+// retryPolicy makes gRPC retry the calls that fail with one of
+// RetryableStatusCodes, with an exponential backoff between InitialBackoff
+// and MaxBackoff. The backoffs are durations in the format of the proto3
+// JSON mapping, such as "0.1s". gRPC jitters the backoffs, and only retries
+// the streams until they receive their first message.
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+// retryThrottling stops the retries while more than half of the calls fail,
+// so that the retries don't overload a server that is already failing.
+type retryThrottling struct {
+	MaxTokens  int     `json:"maxTokens"`
+	TokenRatio float64 `json:"tokenRatio"`
+}
+
+// newServiceConfig returns the default service config of the connection,
+// with the load balancing policy policy and the retries of attempts.
+func newServiceConfig(policy string, attempts upstreamAttempts) (string, error) {
+	sc := serviceConfig{
+		LoadBalancingConfig: []map[string]struct{}{{policy: {}}},
+		MethodConfig:        attempts.methodConfig(),
+	}
+	if sc.MethodConfig != nil {
+		sc.RetryThrottling = &retryThrottling{MaxTokens: 10, TokenRatio: 0.1}
+	}
+	b, err := json.Marshal(sc)
+	return string(b), err
+}
@@ -18,7 +18,7 @@
 
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.28.0
+// 	protoc-gen-go v1.28.1
 // 	protoc        v3.19.4
 // source: shakesapp.proto
 
@@ -38,6 +38,59 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// MatchMode specifies how the query is matched against each line.
+type MatchMode int32
+
+const (
+	// REGEX matches lines against the query as a regular expression.
+	MatchMode_REGEX MatchMode = 0
+	// LITERAL matches lines containing the query as a plain substring.
+	MatchMode_LITERAL MatchMode = 1
+	// WHOLE_WORD matches lines containing the query as a whole word.
+	MatchMode_WHOLE_WORD MatchMode = 2
+)
+
+// Enum value maps for MatchMode.
+var (
+	MatchMode_name = map[int32]string{
+		0: "REGEX",
+		1: "LITERAL",
+		2: "WHOLE_WORD",
+	}
+	MatchMode_value = map[string]int32{
+		"REGEX":      0,
+		"LITERAL":    1,
+		"WHOLE_WORD": 2,
+	}
+)
+
+func (x MatchMode) Enum() *MatchMode {
+	p := new(MatchMode)
+	*p = x
+	return p
+}
+
+func (x MatchMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MatchMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_shakesapp_proto_enumTypes[0].Descriptor()
+}
+
+func (MatchMode) Type() protoreflect.EnumType {
+	return &file_shakesapp_proto_enumTypes[0]
+}
+
+func (x MatchMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MatchMode.Descriptor instead.
+func (MatchMode) EnumDescriptor() ([]byte, []int) {
+	return file_shakesapp_proto_rawDescGZIP(), []int{0}
+}
+
 type ShakespeareResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -93,6 +146,10 @@ type ShakespeareRequest struct {
 
 	// query is a substring query.
 	Query string `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// case_sensitive disables the case-insensitive matching of the query.
+	CaseSensitive bool `protobuf:"varint,2,opt,name=case_sensitive,json=caseSensitive,proto3" json:"case_sensitive,omitempty"`
+	// match_mode is how the query is matched. Defaults to REGEX.
+	MatchMode MatchMode `protobuf:"varint,3,opt,name=match_mode,json=matchMode,proto3,enum=shakesapp.MatchMode" json:"match_mode,omitempty"`
 }
 
 func (x *ShakespeareRequest) Reset() {
@@ -134,6 +191,193 @@ func (x *ShakespeareRequest) GetQuery() string {
 	return ""
 }
 
+func (x *ShakespeareRequest) GetCaseSensitive() bool {
+	if x != nil {
+		return x.CaseSensitive
+	}
+	return false
+}
+
+func (x *ShakespeareRequest) GetMatchMode() MatchMode {
+	if x != nil {
+		return x.MatchMode
+	}
+	return MatchMode_REGEX
+}
+
+type BatchShakespeareRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// queries are substring queries, matched literally.
+	Queries []string `protobuf:"bytes,1,rep,name=queries,proto3" json:"queries,omitempty"`
+	// case_sensitive disables the case-insensitive matching of the queries.
+	CaseSensitive bool `protobuf:"varint,2,opt,name=case_sensitive,json=caseSensitive,proto3" json:"case_sensitive,omitempty"`
+}
+
+func (x *BatchShakespeareRequest) Reset() {
+	*x = BatchShakespeareRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_shakesapp_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchShakespeareRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchShakespeareRequest) ProtoMessage() {}
+
+func (x *BatchShakespeareRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_shakesapp_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchShakespeareRequest.ProtoReflect.Descriptor instead.
+func (*BatchShakespeareRequest) Descriptor() ([]byte, []int) {
+	return file_shakesapp_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchShakespeareRequest) GetQueries() []string {
+	if x != nil {
+		return x.Queries
+	}
+	return nil
+}
+
+func (x *BatchShakespeareRequest) GetCaseSensitive() bool {
+	if x != nil {
+		return x.CaseSensitive
+	}
+	return false
+}
+
+type BatchShakespeareResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// match_counts are the numbers of matching lines, in the order of the
+	// queries.
+	MatchCounts []int64 `protobuf:"varint,1,rep,packed,name=match_counts,json=matchCounts,proto3" json:"match_counts,omitempty"`
+}
+
+func (x *BatchShakespeareResponse) Reset() {
+	*x = BatchShakespeareResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_shakesapp_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchShakespeareResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchShakespeareResponse) ProtoMessage() {}
+
+func (x *BatchShakespeareResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_shakesapp_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchShakespeareResponse.ProtoReflect.Descriptor instead.
+func (*BatchShakespeareResponse) Descriptor() ([]byte, []int) {
+	return file_shakesapp_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchShakespeareResponse) GetMatchCounts() []int64 {
+	if x != nil {
+		return x.MatchCounts
+	}
+	return nil
+}
+
+type PartialMatchCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// file is the name of the text that has just been read.
+	File string `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	// files is the number of texts read so far.
+	Files int32 `protobuf:"varint,2,opt,name=files,proto3" json:"files,omitempty"`
+	// match_count is the number of matching lines read so far, in all the
+	// texts.
+	MatchCount int64 `protobuf:"varint,3,opt,name=match_count,json=matchCount,proto3" json:"match_count,omitempty"`
+}
+
+func (x *PartialMatchCount) Reset() {
+	*x = PartialMatchCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_shakesapp_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PartialMatchCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PartialMatchCount) ProtoMessage() {}
+
+func (x *PartialMatchCount) ProtoReflect() protoreflect.Message {
+	mi := &file_shakesapp_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PartialMatchCount.ProtoReflect.Descriptor instead.
+func (*PartialMatchCount) Descriptor() ([]byte, []int) {
+	return file_shakesapp_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PartialMatchCount) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *PartialMatchCount) GetFiles() int32 {
+	if x != nil {
+		return x.Files
+	}
+	return 0
+}
+
+func (x *PartialMatchCount) GetMatchCount() int64 {
+	if x != nil {
+		return x.MatchCount
+	}
+	return 0
+}
+
 var File_shakesapp_proto protoreflect.FileDescriptor
 
 var file_shakesapp_proto_rawDesc = []byte{
@@ -142,16 +386,52 @@ var file_shakesapp_proto_rawDesc = []byte{
 	0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
 	0x6e, 0x73, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x5f, 0x63, 0x6f, 0x75,
 	0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x43,
-	0x6f, 0x75, 0x6e, 0x74, 0x22, 0x2a, 0x0a, 0x12, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65,
-	0x61, 0x72, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75,
-	0x65, 0x72, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72, 0x79,
-	0x32, 0x66, 0x0a, 0x12, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x53,
-	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x50, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x4d, 0x61, 0x74,
+	0x6f, 0x75, 0x6e, 0x74, 0x22, 0x86, 0x01, 0x0a, 0x12, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70,
+	0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x71,
+	0x75, 0x65, 0x72, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x71, 0x75, 0x65, 0x72,
+	0x79, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x61, 0x73, 0x65, 0x5f, 0x73, 0x65, 0x6e, 0x73, 0x69, 0x74,
+	0x69, 0x76, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x63, 0x61, 0x73, 0x65, 0x53,
+	0x65, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x12, 0x33, 0x0a, 0x0a, 0x6d, 0x61, 0x74, 0x63,
+	0x68, 0x5f, 0x6d, 0x6f, 0x64, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x14, 0x2e, 0x73,
+	0x68, 0x61, 0x6b, 0x65, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x4d, 0x6f,
+	0x64, 0x65, 0x52, 0x09, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x4d, 0x6f, 0x64, 0x65, 0x22, 0x5a, 0x0a,
+	0x17, 0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x71, 0x75, 0x65, 0x72,
+	0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x71, 0x75, 0x65, 0x72, 0x69,
+	0x65, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x61, 0x73, 0x65, 0x5f, 0x73, 0x65, 0x6e, 0x73, 0x69,
+	0x74, 0x69, 0x76, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x63, 0x61, 0x73, 0x65,
+	0x53, 0x65, 0x6e, 0x73, 0x69, 0x74, 0x69, 0x76, 0x65, 0x22, 0x3d, 0x0a, 0x18, 0x42, 0x61, 0x74,
+	0x63, 0x68, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x5f, 0x63,
+	0x6f, 0x75, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x03, 0x52, 0x0b, 0x6d, 0x61, 0x74,
+	0x63, 0x68, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x22, 0x5e, 0x0a, 0x11, 0x50, 0x61, 0x72, 0x74,
+	0x69, 0x61, 0x6c, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x12, 0x0a,
+	0x04, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66, 0x69, 0x6c,
+	0x65, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x05, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x61, 0x74, 0x63, 0x68,
+	0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x6d, 0x61,
+	0x74, 0x63, 0x68, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x2a, 0x33, 0x0a, 0x09, 0x4d, 0x61, 0x74, 0x63,
+	0x68, 0x4d, 0x6f, 0x64, 0x65, 0x12, 0x09, 0x0a, 0x05, 0x52, 0x45, 0x47, 0x45, 0x58, 0x10, 0x00,
+	0x12, 0x0b, 0x0a, 0x07, 0x4c, 0x49, 0x54, 0x45, 0x52, 0x41, 0x4c, 0x10, 0x01, 0x12, 0x0e, 0x0a,
+	0x0a, 0x57, 0x48, 0x4f, 0x4c, 0x45, 0x5f, 0x57, 0x4f, 0x52, 0x44, 0x10, 0x02, 0x32, 0x98, 0x02,
+	0x0a, 0x12, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x12, 0x50, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x4d, 0x61, 0x74, 0x63, 0x68,
+	0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x1d, 0x2e, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x61, 0x70,
+	0x70, 0x2e, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x61, 0x70, 0x70,
+	0x2e, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x5b, 0x0a, 0x0e, 0x47, 0x65, 0x74, 0x4d, 0x61, 0x74,
+	0x63, 0x68, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x12, 0x22, 0x2e, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x73, 0x61, 0x70, 0x70, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73,
+	0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x23, 0x2e, 0x73,
+	0x68, 0x61, 0x6b, 0x65, 0x73, 0x61, 0x70, 0x70, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x68,
+	0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x12, 0x53, 0x0a, 0x10, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4d, 0x61, 0x74,
 	0x63, 0x68, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x1d, 0x2e, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x73,
 	0x61, 0x70, 0x70, 0x2e, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x61,
-	0x70, 0x70, 0x2e, 0x53, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x70, 0x65, 0x61, 0x72, 0x65, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x0e, 0x5a, 0x0c, 0x2e, 0x2f, 0x3b, 0x73,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x73, 0x61,
+	0x70, 0x70, 0x2e, 0x50, 0x61, 0x72, 0x74, 0x69, 0x61, 0x6c, 0x4d, 0x61, 0x74, 0x63, 0x68, 0x43,
+	0x6f, 0x75, 0x6e, 0x74, 0x22, 0x00, 0x30, 0x01, 0x42, 0x0e, 0x5a, 0x0c, 0x2e, 0x2f, 0x3b, 0x73,
 	0x68, 0x61, 0x6b, 0x65, 0x73, 0x61, 0x70, 0x70, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
@@ -167,19 +447,29 @@ func file_shakesapp_proto_rawDescGZIP() []byte {
 	return file_shakesapp_proto_rawDescData
 }
 
-var file_shakesapp_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_shakesapp_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_shakesapp_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_shakesapp_proto_goTypes = []interface{}{
-	(*ShakespeareResponse)(nil), // 0: shakesapp.ShakespeareResponse
-	(*ShakespeareRequest)(nil),  // 1: shakesapp.ShakespeareRequest
+	(MatchMode)(0),                   // 0: shakesapp.MatchMode
+	(*ShakespeareResponse)(nil),      // 1: shakesapp.ShakespeareResponse
+	(*ShakespeareRequest)(nil),       // 2: shakesapp.ShakespeareRequest
+	(*BatchShakespeareRequest)(nil),  // 3: shakesapp.BatchShakespeareRequest
+	(*BatchShakespeareResponse)(nil), // 4: shakesapp.BatchShakespeareResponse
+	(*PartialMatchCount)(nil),        // 5: shakesapp.PartialMatchCount
 }
 var file_shakesapp_proto_depIdxs = []int32{
-	1, // 0: shakesapp.ShakespeareService.GetMatchCount:input_type -> shakesapp.ShakespeareRequest
-	0, // 1: shakesapp.ShakespeareService.GetMatchCount:output_type -> shakesapp.ShakespeareResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: shakesapp.ShakespeareRequest.match_mode:type_name -> shakesapp.MatchMode
+	2, // 1: shakesapp.ShakespeareService.GetMatchCount:input_type -> shakesapp.ShakespeareRequest
+	3, // 2: shakesapp.ShakespeareService.GetMatchCounts:input_type -> shakesapp.BatchShakespeareRequest
+	2, // 3: shakesapp.ShakespeareService.StreamMatchCount:input_type -> shakesapp.ShakespeareRequest
+	1, // 4: shakesapp.ShakespeareService.GetMatchCount:output_type -> shakesapp.ShakespeareResponse
+	4, // 5: shakesapp.ShakespeareService.GetMatchCounts:output_type -> shakesapp.BatchShakespeareResponse
+	5, // 6: shakesapp.ShakespeareService.StreamMatchCount:output_type -> shakesapp.PartialMatchCount
+	4, // [4:7] is the sub-list for method output_type
+	1, // [1:4] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_shakesapp_proto_init() }
@@ -212,19 +502,56 @@ func file_shakesapp_proto_init() {
 				return nil
 			}
 		}
+		file_shakesapp_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchShakespeareRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_shakesapp_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchShakespeareResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_shakesapp_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PartialMatchCount); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_shakesapp_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      1,
+			NumMessages:   5,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_shakesapp_proto_goTypes,
 		DependencyIndexes: file_shakesapp_proto_depIdxs,
+		EnumInfos:         file_shakesapp_proto_enumTypes,
 		MessageInfos:      file_shakesapp_proto_msgTypes,
 	}.Build()
 	File_shakesapp_proto = out.File
@@ -0,0 +1,141 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// partialEvent is the data of the partial events of /v1/query/stream: the
+// count of the lines read so far, once file has been read.
+type partialEvent struct {
+	File       string `json:"file"`
+	Files      int32  `json:"files"`
+	MatchCount int64  `json:"match_count"`
+}
+
+// streamHandler accepts the same parameters as handler and forwards the
+// partial counts of a StreamMatchCount call to the server as Server-Sent
+// Events: a partial event for every text read by the server, then a done
+// event with a queryResponse, or an error event with an errorResponse when
+// the call fails after the first event. The partial counts are also recorded
+// as events of the span of the HTTP request.
+func (cs *clientService) streamHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := cs.parseQuery(r)
+	if err != nil {
+		writeError(r.Context(), w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(r.Context(), w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cs.upstreamTimeout)
+	defer cancel()
+	span := trace.SpanFromContext(ctx)
+	start := time.Now()
+	cli := shakesapp.NewShakespeareServiceClient(cs.serverSvcConn)
+	stream, err := cli.StreamMatchCount(ctx, req)
+	if err != nil {
+		writeRPCError(ctx, w, "StreamMatchCount", err)
+		return
+	}
+
+	// the status is sent with the first event, so that the errors of the
+	// call before it get their own status.
+	started := false
+	begin := func() {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+	var last partialEvent
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if !started {
+				writeRPCError(ctx, w, "StreamMatchCount", err)
+				return
+			}
+			slog.ErrorContext(ctx, "error calling StreamMatchCount", "error", err)
+			writeEvent(w, "error", errorResponse{
+				Error: errorDetail{
+					Code:    rpcStatus(err),
+					Message: fmt.Sprintf("error calling StreamMatchCount: %v", err),
+				},
+				RequestID: telemetry.RequestIDFromContext(ctx),
+			})
+			flusher.Flush()
+			return
+		}
+		begin()
+		last = partialEvent{File: msg.File, Files: msg.Files, MatchCount: msg.MatchCount}
+		span.AddEvent("partial count", trace.WithAttributes(
+			attribute.Key("file").String(msg.File),
+			attribute.Key("files").Int(int(msg.Files)),
+			attribute.Key("matched").Int64(msg.MatchCount),
+		))
+		writeEvent(w, "partial", last)
+		flusher.Flush()
+	}
+
+	span.SetAttributes(
+		attribute.Key("files").Int(int(last.Files)),
+		attribute.Key("matched").Int64(last.MatchCount),
+	)
+	slog.InfoContext(ctx, "streamed query", "files", last.Files, "match_count", last.MatchCount)
+	begin()
+	writeEvent(w, "done", queryResponse{
+		Query:         req.Query,
+		CaseSensitive: req.CaseSensitive,
+		MatchMode:     req.MatchMode.String(),
+		MatchCount:    last.MatchCount,
+		Timing: queryTiming{
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		},
+		RequestID: telemetry.RequestIDFromContext(ctx),
+	})
+	flusher.Flush()
+}
+
+// writeEvent writes data as JSON in a Server-Sent Event named event.
+func writeEvent(w io.Writer, event string, data any) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		b = []byte(`{}`)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp/syntax"
+	"strconv"
+	"unicode/utf8"
+
+	"opentelemetry-trace-codelab-go/client/shakesapp"
+)
+
+const (
+	defaultMaxQueryLength = 256
+
+	// maxRegexpInsts bounds the size of the program of a regular expression
+	// query. The regular expressions of Go run in linear time, but large
+	// repetitions such as a{1000} compile to huge programs, which the server
+	// would compile and run on every line of the corpus.
+	maxRegexpInsts = 1000
+)
+
+// queryValidator rejects the queries that the server shouldn't see.
+type queryValidator struct {
+	maxLength int
+}
+
+// newQueryValidator returns a validator of the queries of at most
+// MAX_QUERY_LENGTH characters, which defaults to 256.
+func newQueryValidator() (queryValidator, error) {
+	v := queryValidator{maxLength: defaultMaxQueryLength}
+	if s := os.Getenv("MAX_QUERY_LENGTH"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return v, fmt.Errorf("MAX_QUERY_LENGTH must be a positive integer, got %q", s)
+		}
+		v.maxLength = n
+	}
+	return v, nil
+}
+
+// validate returns an error when query is empty or too long, or when it is a
+// regular expression in mode that doesn't parse or that is too large.
+func (v queryValidator) validate(query string, mode shakesapp.MatchMode) error {
+	if query == "" {
+		return fmt.Errorf("missing query parameter q")
+	}
+	if n := utf8.RuneCountInString(query); n > v.maxLength {
+		return fmt.Errorf("query must be at most %d characters, got %d", v.maxLength, n)
+	}
+	if mode != shakesapp.MatchMode_REGEX {
+		return nil
+	}
+	re, err := syntax.Parse(query, syntax.Perl)
+	if err != nil {
+		// the errors of syntax quote the expression, which is the raw query.
+		var serr *syntax.Error
+		if errors.As(err, &serr) {
+			return fmt.Errorf("invalid regular expression: %s", serr.Code)
+		}
+		return fmt.Errorf("invalid regular expression: %v", err)
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return fmt.Errorf("invalid regular expression: %v", err)
+	}
+	if len(prog.Inst) > maxRegexpInsts {
+		return fmt.Errorf("regular expression is too complex")
+	}
+	return nil
+}
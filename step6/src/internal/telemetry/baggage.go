@@ -0,0 +1,84 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// The keys of the W3C baggage that the client sends to the server with its
+// calls.
+const (
+	// BaggageRequestID is the ID of the request to the client.
+	BaggageRequestID = "request.id"
+	// BaggageAPIVersion is the version of the API of the client that served
+	// the request, e.g. "v1".
+	BaggageAPIVersion = "api.version"
+	// BaggageClientPod is the name of the pod of the client.
+	BaggageClientPod = "client.pod.name"
+)
+
+// defaultBaggageAttributes are the baggage entries that the
+// baggageSpanProcessor copies by default.
+var defaultBaggageAttributes = []string{BaggageRequestID, BaggageAPIVersion, BaggageClientPod}
+
+// baggageSpanProcessor copies the entries of the baggage of the parent context
+// of the spans onto them as attributes, when the spans start.
+type baggageSpanProcessor struct {
+	keys map[string]bool
+}
+
+// NewBaggageSpanProcessor creates a processor that records the entries of the
+// W3C baggage propagated with a request on all the spans of the request, so
+// that the spans of the server can be searched by the request ID or by the pod
+// of the client that made the call. Only the keys listed in the comma
+// separated OTEL_BAGGAGE_SPAN_ATTRIBUTES environment variable are copied, so
+// that the callers can't add arbitrary attributes to the spans. It defaults to
+// the keys that the client sets, and "none" returns a nil processor.
+func NewBaggageSpanProcessor() sdktrace.SpanProcessor {
+	keys := defaultBaggageAttributes
+	if v := os.Getenv("OTEL_BAGGAGE_SPAN_ATTRIBUTES"); v == "none" {
+		return nil
+	} else if v != "" {
+		keys = strings.Split(v, ",")
+	}
+	p := baggageSpanProcessor{keys: map[string]bool{}}
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			p.keys[k] = true
+		}
+	}
+	return p
+}
+
+func (p baggageSpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	for _, m := range baggage.FromContext(parent).Members() {
+		if p.keys[m.Key()] {
+			s.SetAttributes(attribute.String(m.Key(), m.Value()))
+		}
+	}
+}
+
+func (p baggageSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {}
+
+func (p baggageSpanProcessor) Shutdown(ctx context.Context) error { return nil }
+
+func (p baggageSpanProcessor) ForceFlush(ctx context.Context) error { return nil }
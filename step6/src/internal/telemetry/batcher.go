@@ -0,0 +1,87 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewBatchSpanProcessor creates a BatchSpanProcessor of exporter tuned with
+// the OTEL_BSP_* environment variables defined in the OpenTelemetry
+// specification:
+//
+//   - OTEL_BSP_MAX_QUEUE_SIZE (2048) bounds the spans waiting to be exported.
+//     The spans ended while the queue is full are dropped, which shows up as
+//     incomplete traces under heavy load.
+//   - OTEL_BSP_MAX_EXPORT_BATCH_SIZE (512) bounds the spans of an export.
+//   - OTEL_BSP_SCHEDULE_DELAY (5000) is the delay between two exports, in
+//     milliseconds.
+//   - OTEL_BSP_EXPORT_TIMEOUT (30000) bounds an export, in milliseconds.
+//
+// Unlike the SDK, which ignores the invalid values, it fails on them, and it
+// logs the effective settings at startup.
+func NewBatchSpanProcessor(exporter sdktrace.SpanExporter) (sdktrace.SpanProcessor, error) {
+	queueSize, err := positiveEnv("OTEL_BSP_MAX_QUEUE_SIZE", sdktrace.DefaultMaxQueueSize)
+	if err != nil {
+		return nil, err
+	}
+	batchSize, err := positiveEnv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", sdktrace.DefaultMaxExportBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize > queueSize {
+		return nil, fmt.Errorf("OTEL_BSP_MAX_EXPORT_BATCH_SIZE (%d) must not exceed OTEL_BSP_MAX_QUEUE_SIZE (%d)", batchSize, queueSize)
+	}
+	delay, err := positiveEnv("OTEL_BSP_SCHEDULE_DELAY", sdktrace.DefaultScheduleDelay)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := positiveEnv("OTEL_BSP_EXPORT_TIMEOUT", sdktrace.DefaultExportTimeout)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("configured the span batcher",
+		"max_queue_size", queueSize,
+		"max_export_batch_size", batchSize,
+		"schedule_delay_ms", delay,
+		"export_timeout_ms", timeout,
+	)
+	return sdktrace.NewBatchSpanProcessor(exporter,
+		sdktrace.WithMaxQueueSize(queueSize),
+		sdktrace.WithMaxExportBatchSize(batchSize),
+		sdktrace.WithBatchTimeout(time.Duration(delay)*time.Millisecond),
+		sdktrace.WithExportTimeout(time.Duration(timeout)*time.Millisecond),
+	), nil
+}
+
+// positiveEnv parses the environment variable key as a positive integer, and
+// returns def when it is not set.
+func positiveEnv(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", key, v)
+	}
+	return n, nil
+}
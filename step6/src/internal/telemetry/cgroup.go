@@ -0,0 +1,129 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const (
+	// cgroupRoot is where the cgroup of the container is mounted.
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// memoryLimitRatio is the share of the memory limit of the container that
+	// SetMemoryLimit gives to the Go heap, leaving room for the rest of the
+	// process.
+	memoryLimitRatio = 0.9
+)
+
+// SetMaxProcs sets GOMAXPROCS to the CPU limit of the container, rounded down
+// and at least 1, so that the Go runtime doesn't schedule goroutines on more
+// threads than the CPU quota of the pod allows, which would throttle the
+// process and skew both the latency and the profiles. It leaves GOMAXPROCS
+// unchanged when the GOMAXPROCS environment variable is set or the container
+// has no CPU limit. It returns the value of GOMAXPROCS.
+func SetMaxProcs() int {
+	if os.Getenv("GOMAXPROCS") != "" {
+		return runtime.GOMAXPROCS(0)
+	}
+	quota, ok := cpuQuota()
+	if !ok {
+		return runtime.GOMAXPROCS(0)
+	}
+	procs := max(int(quota), 1)
+	if procs < runtime.NumCPU() {
+		runtime.GOMAXPROCS(procs)
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// SetMemoryLimit sets the soft memory limit of the Go runtime to 90% of the
+// memory limit of the container, so that the garbage collector runs harder as
+// the heap, e.g. the corpus cache of the server, gets close to the limit
+// instead of letting the pod be OOM-killed. It leaves the limit unchanged when
+// GOMEMLIMIT is set or the container has no memory limit. It returns the
+// limit, which is math.MaxInt64 when there is none.
+func SetMemoryLimit() int64 {
+	if os.Getenv("GOMEMLIMIT") != "" {
+		return debug.SetMemoryLimit(-1)
+	}
+	limit, ok := memoryLimit()
+	if !ok {
+		return debug.SetMemoryLimit(-1)
+	}
+	debug.SetMemoryLimit(int64(float64(limit) * memoryLimitRatio))
+	return debug.SetMemoryLimit(-1)
+}
+
+// memoryLimit returns the memory limit of the container in bytes, from
+// memory.max with cgroup v2 or from memory.limit_in_bytes with cgroup v1.
+func memoryLimit() (int64, bool) {
+	b, err := os.ReadFile(cgroupRoot + "/memory.max")
+	if err != nil {
+		b, err = os.ReadFile(cgroupRoot + "/memory/memory.limit_in_bytes")
+		if err != nil {
+			return 0, false
+		}
+	}
+	// "max" with cgroup v2, or a value close to math.MaxInt64 with cgroup v1,
+	// when there is no limit.
+	limit, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || limit <= 0 || limit >= math.MaxInt64/2 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// cpuQuota returns the CPU limit of the container in cores, from cpu.max with
+// cgroup v2 or from cpu.cfs_quota_us and cpu.cfs_period_us with cgroup v1.
+func cpuQuota() (float64, bool) {
+	if b, err := os.ReadFile(cgroupRoot + "/cpu.max"); err == nil {
+		// "max 100000" when there is no limit.
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 {
+			return 0, false
+		}
+		return quotaRatio(fields[0], fields[1])
+	}
+	quota, err := os.ReadFile(cgroupRoot + "/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0, false
+	}
+	period, err := os.ReadFile(cgroupRoot + "/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, false
+	}
+	// the quota is -1 when there is no limit.
+	return quotaRatio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// quotaRatio returns quota divided by period, or false when quota is not a
+// positive number.
+func quotaRatio(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
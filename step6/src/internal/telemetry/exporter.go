@@ -0,0 +1,63 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry holds the OpenTelemetry setup shared by the loadgen, the
+// client and the server, so that all of them can be configured with the same
+// environment variables.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	cloudtrace "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	stdout "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewExporter creates the span exporter selected with the OTEL_EXPORTER
+// environment variable:
+//
+//   - "cloudtrace" (default) sends spans to Cloud Trace.
+//   - "otlp" sends spans to OTEL_EXPORTER_OTLP_ENDPOINT, e.g. an OpenTelemetry
+//     Collector sidecar. Set OTEL_EXPORTER_OTLP_INSECURE=true when the
+//     collector doesn't serve TLS.
+//   - "zipkin" sends spans to OTEL_EXPORTER_ZIPKIN_ENDPOINT.
+//   - "stdout" prints spans to stdout.
+//
+// Jaeger receives OTLP natively: use "otlp" with the OTLP gRPC port of
+// Jaeger, 4317, as the endpoint.
+func NewExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch e := os.Getenv("OTEL_EXPORTER"); e {
+	case "", "cloudtrace":
+		// step3. replace stdout exporter with Cloud Trace exporter
+		// cloudtrace.New() finds the credentials to Cloud Trace automatically following the
+		// rules defined by golang.org/x/oauth2/google.findDefaultCredentailsWithParams.
+		// https://pkg.go.dev/golang.org/x/oauth2/google#FindDefaultCredentialsWithParams
+		return cloudtrace.New()
+		// step3. end replacing exporter
+	case "otlp":
+		return otlptracegrpc.New(ctx)
+	case "zipkin":
+		// an empty collector URL makes the exporter read OTEL_EXPORTER_ZIPKIN_ENDPOINT.
+		return zipkin.New("")
+	case "stdout":
+		return stdout.New(stdout.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown OTEL_EXPORTER %q", e)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	healthServicePrefix = "grpc.health.v1.Health/"
+)
+
+// healthHTTPPaths are the liveness and readiness endpoints of the client.
+var healthHTTPPaths = []string{"/healthz", "/readyz", "/_genki"}
+
+// healthCheckFilter drops the spans of the health checks before they reach the
+// wrapped processor. In GKE, the probes of the kubelet would otherwise make
+// the majority of the exported spans.
+type healthCheckFilter struct {
+	sdktrace.SpanProcessor
+}
+
+// NewHealthCheckFilter wraps next so that the spans of the gRPC health service
+// and of the /healthz, /readyz and /_genki HTTP endpoints are not exported.
+func NewHealthCheckFilter(next sdktrace.SpanProcessor) sdktrace.SpanProcessor {
+	return healthCheckFilter{next}
+}
+
+func (f healthCheckFilter) OnEnd(s sdktrace.ReadOnlySpan) {
+	if isHealthCheck(s) {
+		return
+	}
+	f.SpanProcessor.OnEnd(s)
+}
+
+func isHealthCheck(s sdktrace.ReadOnlySpan) bool {
+	if strings.HasPrefix(s.Name(), healthServicePrefix) {
+		return true
+	}
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case "http.target", "url.path":
+			for _, p := range healthHTTPPaths {
+				if strings.HasPrefix(kv.Value.AsString(), p) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewSpanLimits returns the limits of the spans set with the
+// OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT, OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT,
+// OTEL_SPAN_EVENT_COUNT_LIMIT, OTEL_SPAN_LINK_COUNT_LIMIT,
+// OTEL_EVENT_ATTRIBUTE_COUNT_LIMIT and OTEL_LINK_ATTRIBUTE_COUNT_LIMIT
+// environment variables, or the defaults of the SDK. A negative limit means
+// no limit. The attributes beyond the limits are dropped and the string values
+// longer than the limit are truncated, e.g. set
+// OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT to 8 to see the queries truncated.
+func NewSpanLimits() (sdktrace.SpanLimits, error) {
+	limits := sdktrace.SpanLimits{
+		AttributeValueLengthLimit:   sdktrace.DefaultAttributeValueLengthLimit,
+		AttributeCountLimit:         sdktrace.DefaultAttributeCountLimit,
+		EventCountLimit:             sdktrace.DefaultEventCountLimit,
+		LinkCountLimit:              sdktrace.DefaultLinkCountLimit,
+		AttributePerEventCountLimit: sdktrace.DefaultAttributePerEventCountLimit,
+		AttributePerLinkCountLimit:  sdktrace.DefaultAttributePerLinkCountLimit,
+	}
+	for key, limit := range map[string]*int{
+		"OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT": &limits.AttributeValueLengthLimit,
+		"OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT":        &limits.AttributeCountLimit,
+		"OTEL_SPAN_EVENT_COUNT_LIMIT":            &limits.EventCountLimit,
+		"OTEL_SPAN_LINK_COUNT_LIMIT":             &limits.LinkCountLimit,
+		"OTEL_EVENT_ATTRIBUTE_COUNT_LIMIT":       &limits.AttributePerEventCountLimit,
+		"OTEL_LINK_ATTRIBUTE_COUNT_LIMIT":        &limits.AttributePerLinkCountLimit,
+	} {
+		v := os.Getenv(key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return limits, fmt.Errorf("%s must be an integer, got %q", key, v)
+		}
+		*limit = n
+	}
+	return limits, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/detectors/gcp"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewLogger creates a logger that writes JSON lines to stdout in the format
+// of the structured logs of Cloud Logging, so that GKE parses their severity,
+// message and timestamp. The records logged with a context that holds a span
+// carry its trace_id and span_id, so that the log lines can be correlated with
+// the traces. The records logged with a context that holds a request ID carry
+// it in request_id, see ContextWithRequestID.
+//
+// The records are also emitted as OpenTelemetry log records of the logger
+// named name from lp, which exports them with the resource of the service and
+// the trace context of the log call. lp may be nil to only write to stdout.
+func NewLogger(name string, lp log.LoggerProvider) *slog.Logger {
+	opts := &slog.HandlerOptions{ReplaceAttr: cloudLoggingAttr}
+	var h slog.Handler = traceHandler{
+		Handler:   slog.NewJSONHandler(os.Stdout, opts),
+		projectID: cachedProjectID(),
+	}
+	if lp != nil {
+		h = fanoutHandler{h, otelHandler{logger: lp.Logger(name)}}
+	}
+	return slog.New(requestIDHandler{h})
+}
+
+// fanoutHandler passes the records to all of its handlers.
+type fanoutHandler []slog.Handler
+
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hs := make(fanoutHandler, len(f))
+	for i, h := range f {
+		hs[i] = h.WithAttrs(attrs)
+	}
+	return hs
+}
+
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	hs := make(fanoutHandler, len(f))
+	for i, h := range f {
+		hs[i] = h.WithGroup(name)
+	}
+	return hs
+}
+
+// cloudLoggingAttr renames the built-in attributes of slog to the fields that
+// Cloud Logging reads from the JSON payload.
+func cloudLoggingAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		a.Key = "severity"
+		if level, ok := a.Value.Any().(slog.Level); ok {
+			a.Value = slog.StringValue(severity(level))
+		}
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.TimeKey:
+		a.Key = "timestamp"
+	}
+	return a
+}
+
+// severity maps level to the LogSeverity of Cloud Logging.
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity
+func severity(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// traceHandler adds the trace context of the log call to the records.
+// When the project ID is known, it also adds the fields that Cloud Logging
+// uses to link the log entries to Cloud Trace.
+// https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+type traceHandler struct {
+	slog.Handler
+	projectID string
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+		if h.projectID != "" {
+			r.AddAttrs(
+				slog.String("logging.googleapis.com/trace", fmt.Sprintf("projects/%s/traces/%s", h.projectID, sc.TraceID())),
+				slog.String("logging.googleapis.com/spanId", sc.SpanID().String()),
+				slog.Bool("logging.googleapis.com/trace_sampled", sc.IsSampled()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{Handler: h.Handler.WithAttrs(attrs), projectID: h.projectID}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{Handler: h.Handler.WithGroup(name), projectID: h.projectID}
+}
+
+// TraceURL returns the URL of the trace traceID in the Cloud Trace console, so
+// that a log line can point to the trace of a request. When the project is
+// unknown, the URL has a PROJECT_ID placeholder to replace with the project.
+func TraceURL(traceID trace.TraceID) string {
+	project := cachedProjectID()
+	if project == "" {
+		project = "PROJECT_ID"
+	}
+	return fmt.Sprintf("https://console.cloud.google.com/traces/list?project=%s&tid=%s", project, traceID)
+}
+
+// cachedProjectID returns the result of projectID, which is only looked up
+// once.
+var cachedProjectID = sync.OnceValue(projectID)
+
+// projectID returns the ID of the Google Cloud project from
+// GOOGLE_CLOUD_PROJECT, or from the metadata server on GCP. It returns an empty
+// string when the project is unknown.
+func projectID() string {
+	if id := os.Getenv("GOOGLE_CLOUD_PROJECT"); id != "" {
+		return id
+	}
+	d := gcp.NewDetector()
+	if d.CloudPlatform() == gcp.UnknownPlatform {
+		return ""
+	}
+	id, err := d.ProjectID()
+	if err != nil {
+		return ""
+	}
+	return id
+}
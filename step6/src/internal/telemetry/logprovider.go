@@ -0,0 +1,142 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// NewLoggerProvider creates a LoggerProvider with the log exporter selected
+// with the OTEL_LOGS_EXPORTER environment variable:
+//
+//   - "otlp" sends log records to OTEL_EXPORTER_OTLP_ENDPOINT, next to the
+//     spans.
+//   - "stdout" prints log records to stdout.
+//   - "none" (default) doesn't export the log records. They are still written
+//     to stdout by NewLogger, where GKE sends them to Cloud Logging.
+func NewLoggerProvider(ctx context.Context, res *resource.Resource) (*sdklog.LoggerProvider, error) {
+	var exporter sdklog.Exporter
+	var err error
+	switch e := os.Getenv("OTEL_LOGS_EXPORTER"); e {
+	case "otlp":
+		exporter, err = otlploggrpc.New(ctx)
+	case "stdout":
+		exporter, err = stdoutlog.New()
+	case "", "none":
+		return sdklog.NewLoggerProvider(sdklog.WithResource(res)), nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_LOGS_EXPORTER %q", e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+	), nil
+}
+
+// otelHandler is a slog.Handler that emits the records as OpenTelemetry log
+// records. The SDK reads the trace context of the record from the context of
+// the log call. The attributes added in a group are prefixed with its name.
+type otelHandler struct {
+	logger log.Logger
+	attrs  []log.KeyValue
+	prefix string
+}
+
+func (h otelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.Enabled(ctx, log.EnabledParameters{Severity: otelSeverity(level)})
+}
+
+func (h otelHandler) Handle(ctx context.Context, r slog.Record) error {
+	var rec log.Record
+	rec.SetTimestamp(r.Time)
+	rec.SetSeverity(otelSeverity(r.Level))
+	rec.SetSeverityText(r.Level.String())
+	rec.SetBody(log.StringValue(r.Message))
+	rec.AddAttributes(h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		rec.AddAttributes(h.keyValue(a))
+		return true
+	})
+	h.logger.Emit(ctx, rec)
+	return nil
+}
+
+func (h otelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	kvs := make([]log.KeyValue, 0, len(h.attrs)+len(attrs))
+	kvs = append(kvs, h.attrs...)
+	for _, a := range attrs {
+		kvs = append(kvs, h.keyValue(a))
+	}
+	h.attrs = kvs
+	return h
+}
+
+func (h otelHandler) WithGroup(name string) slog.Handler {
+	if name != "" {
+		h.prefix += name + "."
+	}
+	return h
+}
+
+func (h otelHandler) keyValue(a slog.Attr) log.KeyValue {
+	return log.KeyValue{Key: h.prefix + a.Key, Value: otelValue(a.Value)}
+}
+
+// otelSeverity maps level to the severity number of OpenTelemetry, where
+// slog.LevelInfo is log.SeverityInfo and the other levels are offset alike.
+func otelSeverity(level slog.Level) log.Severity {
+	return log.Severity(level + 9)
+}
+
+// otelValue converts v to the value of a log record attribute.
+func otelValue(v slog.Value) log.Value {
+	switch v = v.Resolve(); v.Kind() {
+	case slog.KindString:
+		return log.StringValue(v.String())
+	case slog.KindInt64:
+		return log.Int64Value(v.Int64())
+	case slog.KindUint64:
+		return log.Int64Value(int64(v.Uint64()))
+	case slog.KindFloat64:
+		return log.Float64Value(v.Float64())
+	case slog.KindBool:
+		return log.BoolValue(v.Bool())
+	case slog.KindDuration:
+		return log.Int64Value(v.Duration().Nanoseconds())
+	case slog.KindTime:
+		return log.Int64Value(v.Time().UnixNano())
+	case slog.KindGroup:
+		attrs := v.Group()
+		kvs := make([]log.KeyValue, len(attrs))
+		for i, a := range attrs {
+			kvs[i] = log.KeyValue{Key: a.Key, Value: otelValue(a.Value)}
+		}
+		return log.MapValue(kvs...)
+	default:
+		return log.StringValue(fmt.Sprint(v.Any()))
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	mexporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// NewMeterProvider creates a MeterProvider with the metric exporter selected
+// with the OTEL_METRICS_EXPORTER environment variable:
+//
+//   - "cloudmonitoring" sends metrics to Cloud Monitoring, next to the spans in
+//     Cloud Trace.
+//   - "otlp" sends metrics to OTEL_EXPORTER_OTLP_ENDPOINT.
+//   - "stdout" prints metrics to stdout.
+//   - "prometheus" keeps the metrics for the /metrics endpoint served by
+//     MetricsHandler, which Prometheus scrapes.
+//   - "none" doesn't export the metrics.
+//
+// The SDK keeps the trace ID of the sampled spans as exemplars of the
+// histogram buckets, so that Cloud Monitoring links the latency buckets to
+// Cloud Trace. Set OTEL_METRICS_EXEMPLAR_FILTER to "always_off" to disable
+// them.
+//
+// When OTEL_METRICS_EXPORTER is not set, the metrics aren't exported, so that
+// running the services outside of Google Cloud doesn't write to Cloud
+// Monitoring. The manifests set it to "cloudmonitoring".
+func NewMeterProvider(ctx context.Context, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
+	var exporter sdkmetric.Exporter
+	var err error
+	switch e := metricsExporter(); e {
+	case "cloudmonitoring":
+		exporter, err = mexporter.New()
+	case "otlp":
+		exporter, err = otlpmetricgrpc.New(ctx)
+	case "stdout":
+		exporter, err = stdoutmetric.New()
+	case "prometheus":
+		// the Prometheus exporter is a reader, which is collected on scrape
+		// instead of periodically.
+		reader, err := prometheus.New()
+		if err != nil {
+			return nil, err
+		}
+		return sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(reader),
+		), nil
+	case "none":
+		return sdkmetric.NewMeterProvider(sdkmetric.WithResource(res)), nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_METRICS_EXPORTER %q", e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+	), nil
+}
+
+// MetricsHandler returns the handler of the /metrics endpoint in the text
+// format of Prometheus, or nil when OTEL_METRICS_EXPORTER isn't "prometheus".
+func MetricsHandler() http.Handler {
+	if metricsExporter() != "prometheus" {
+		return nil
+	}
+	return promhttp.Handler()
+}
+
+// metricsExporter returns the name of the metric exporter to use.
+func metricsExporter() string {
+	if e := os.Getenv("OTEL_METRICS_EXPORTER"); e != "" {
+		return e
+	}
+	return "none"
+}
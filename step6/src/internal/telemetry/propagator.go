@@ -0,0 +1,70 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	gcppropagator "github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// defaultPropagators are the W3C headers only, so that the services don't send
+// extra trace headers unless OTEL_PROPAGATORS asks for them.
+const defaultPropagators = "tracecontext,baggage"
+
+// NewPropagator creates the composite propagator listed in the comma separated
+// OTEL_PROPAGATORS environment variable:
+//
+//   - "tracecontext" propagates the W3C traceparent and tracestate headers.
+//   - "baggage" propagates the W3C baggage header.
+//   - "b3" propagates the single B3 header, "b3multi" the X-B3-* headers.
+//   - "cloudtrace" propagates Google's X-Cloud-Trace-Context header.
+//   - "none" disables the propagation.
+//
+// When a request carries several trace headers, the propagators listed later
+// take precedence. It defaults to "tracecontext,baggage". Set it to
+// "cloudtrace,b3,tracecontext,baggage" to also accept the trace context of
+// GCLB, Envoy and non-OTel clients, and prefer the W3C headers when several of
+// them are present.
+func NewPropagator() (propagation.TextMapPropagator, error) {
+	names := os.Getenv("OTEL_PROPAGATORS")
+	if names == "" {
+		names = defaultPropagators
+	}
+	var props []propagation.TextMapPropagator
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "tracecontext":
+			props = append(props, propagation.TraceContext{})
+		case "baggage":
+			props = append(props, propagation.Baggage{})
+		case "b3":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "cloudtrace":
+			props = append(props, gcppropagator.CloudTraceFormatPropagator{})
+		case "none":
+			return propagation.NewCompositeTextMapPropagator(), nil
+		default:
+			return nil, fmt.Errorf("unknown OTEL_PROPAGATORS entry %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
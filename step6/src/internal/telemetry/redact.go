@@ -0,0 +1,182 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	defaultRedactedAttributes = "query"
+	truncatedLength           = 3
+	// redactionKeyLength is the length of the random key of the HMAC when
+	// OTEL_REDACTION_KEY is not set.
+	redactionKeyLength = 32
+)
+
+// urlAttributes hold URLs whose query string carries the raw query of the
+// loadgen, e.g. "/?q=love". url.query holds the query string alone.
+var urlAttributes = map[attribute.Key]bool{
+	"http.target": true,
+	"http.url":    true,
+	"url.full":    true,
+}
+
+// redactionProcessor rewrites the attributes in the denylist, and the query
+// strings of the URL attributes, of the span and of its events and links,
+// before the span reaches the wrapped processor.
+type redactionProcessor struct {
+	sdktrace.SpanProcessor
+	denylist map[attribute.Key]bool
+	redact   func(string) string
+}
+
+// NewRedactionProcessor wraps next so that the raw queries are not exported.
+// The keys of the attributes to redact are listed in the comma separated
+// OTEL_REDACTED_ATTRIBUTES environment variable and default to "query".
+// OTEL_REDACTION selects how the values are redacted: "hash" (default)
+// replaces them with their HMAC-SHA256, so that equal values can still be
+// grouped, and "truncate" keeps their first characters only.
+//
+// A plain digest of a short query is reversed by hashing the words of a
+// dictionary, so the HMAC is keyed with OTEL_REDACTION_KEY. Set it to the
+// same secret in all the services to group the values across them. When it
+// isn't set, every process uses a random key of its own.
+func NewRedactionProcessor(next sdktrace.SpanProcessor) (sdktrace.SpanProcessor, error) {
+	p := redactionProcessor{
+		SpanProcessor: next,
+		denylist:      map[attribute.Key]bool{},
+	}
+	switch mode := os.Getenv("OTEL_REDACTION"); mode {
+	case "", "hash":
+		key := []byte(os.Getenv("OTEL_REDACTION_KEY"))
+		if len(key) == 0 {
+			key = make([]byte, redactionKeyLength)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("failed to generate the redaction key: %v", err)
+			}
+		}
+		p.redact = hashValue(key)
+	case "truncate":
+		p.redact = truncateValue
+	default:
+		return nil, fmt.Errorf("unknown OTEL_REDACTION %q", mode)
+	}
+	keys := os.Getenv("OTEL_REDACTED_ATTRIBUTES")
+	if keys == "" {
+		keys = defaultRedactedAttributes
+	}
+	for _, k := range strings.Split(keys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			p.denylist[attribute.Key(k)] = true
+		}
+	}
+	return p, nil
+}
+
+func (p redactionProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	events := s.Events()
+	redactedEvents := make([]sdktrace.Event, len(events))
+	for i, e := range events {
+		e.Attributes = p.redactAttributes(e.Attributes)
+		redactedEvents[i] = e
+	}
+	links := s.Links()
+	redactedLinks := make([]sdktrace.Link, len(links))
+	for i, l := range links {
+		l.Attributes = p.redactAttributes(l.Attributes)
+		redactedLinks[i] = l
+	}
+	p.SpanProcessor.OnEnd(redactedSpan{
+		ReadOnlySpan: s,
+		attrs:        p.redactAttributes(s.Attributes()),
+		events:       redactedEvents,
+		links:        redactedLinks,
+	})
+}
+
+// redactAttributes returns a copy of attrs with their values redacted.
+func (p redactionProcessor) redactAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	redacted := make([]attribute.KeyValue, len(attrs))
+	for i, kv := range attrs {
+		redacted[i] = p.redactAttribute(kv)
+	}
+	return redacted
+}
+
+func (p redactionProcessor) redactAttribute(kv attribute.KeyValue) attribute.KeyValue {
+	if kv.Value.Type() != attribute.STRING {
+		return kv
+	}
+	v := kv.Value.AsString()
+	switch {
+	case p.denylist[kv.Key]:
+		return kv.Key.String(p.redact(v))
+	case kv.Key == "url.query":
+		return kv.Key.String(p.redact(v))
+	case urlAttributes[kv.Key]:
+		if i := strings.IndexByte(v, '?'); i >= 0 {
+			return kv.Key.String(v[:i+1] + p.redact(v[i+1:]))
+		}
+	}
+	return kv
+}
+
+// redactedSpan overrides the attributes, the events and the links of the
+// ended span. The other fields are read from the original span.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+	links  []sdktrace.Link
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return s.attrs
+}
+
+func (s redactedSpan) Events() []sdktrace.Event {
+	return s.events
+}
+
+func (s redactedSpan) Links() []sdktrace.Link {
+	return s.links
+}
+
+// hashValue returns the function that replaces a value with its HMAC-SHA256
+// keyed with key.
+func hashValue(key []byte) func(string) string {
+	return func(v string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(v))
+		return fmt.Sprintf("hmac-sha256:%x", mac.Sum(nil))
+	}
+}
+
+func truncateValue(v string) string {
+	r := []rune(v)
+	if len(r) <= truncatedLength {
+		return v
+	}
+	return string(r[:truncatedLength]) + "..."
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"math"
+	"runtime/debug"
+
+	"github.com/GoogleCloudPlatform/opentelemetry-operations-go/detectors/gcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// NewResource describes the service that emits the spans. On top of
+// service.name and service.version, it carries the GCP platform the service
+// runs on (e.g. the GKE cluster and zone), the soft memory limit of the Go
+// runtime when there is one, and the attributes given in
+// OTEL_RESOURCE_ATTRIBUTES, such as the pod name set in the manifests.
+func NewResource(ctx context.Context, serviceName, serviceVersion string) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(serviceVersion),
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		attrs = append(attrs, attribute.Key("process.runtime.go.mem_limit").Int64(limit))
+	}
+	return resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithDetectors(gcpDetector{}),
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
+	)
+}
+
+// gcpDetector detects the GCP platform with the metadata server and the
+// environment variables set by the platform. It returns an empty resource
+// outside of GCP.
+type gcpDetector struct{}
+
+func (gcpDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	d := gcp.NewDetector()
+	var attrs []attribute.KeyValue
+	// add appends the attribute only when the value could be detected, so that
+	// a single missing metadata doesn't drop the whole resource.
+	add := func(key attribute.Key, value string, err error) {
+		if err == nil && value != "" {
+			attrs = append(attrs, key.String(value))
+		}
+	}
+
+	switch d.CloudPlatform() {
+	case gcp.GKE:
+		attrs = append(attrs, semconv.CloudPlatformGCPKubernetesEngine)
+		name, err := d.GKEClusterName()
+		add(semconv.K8SClusterNameKey, name, err)
+		id, err := d.GKEHostID()
+		add(semconv.HostIDKey, id, err)
+		location, locationType, err := d.GKEAvailabilityZoneOrRegion()
+		switch locationType {
+		case gcp.Zone:
+			add(semconv.CloudAvailabilityZoneKey, location, err)
+		case gcp.Region:
+			add(semconv.CloudRegionKey, location, err)
+		}
+	case gcp.GCE:
+		attrs = append(attrs, semconv.CloudPlatformGCPComputeEngine)
+		id, err := d.GCEHostID()
+		add(semconv.HostIDKey, id, err)
+		name, err := d.GCEHostName()
+		add(semconv.HostNameKey, name, err)
+		hostType, err := d.GCEHostType()
+		add(semconv.HostTypeKey, hostType, err)
+		zone, region, err := d.GCEAvailabilityZoneAndRegion()
+		add(semconv.CloudAvailabilityZoneKey, zone, err)
+		add(semconv.CloudRegionKey, region, err)
+	case gcp.CloudRun:
+		attrs = append(attrs, semconv.CloudPlatformGCPCloudRun)
+		name, err := d.FaaSName()
+		add(semconv.FaaSNameKey, name, err)
+		version, err := d.FaaSVersion()
+		add(semconv.FaaSVersionKey, version, err)
+		id, err := d.FaaSID()
+		add(semconv.FaaSInstanceKey, id, err)
+		region, err := d.FaaSCloudRegion()
+		add(semconv.CloudRegionKey, region, err)
+	default:
+		return resource.Empty(), nil
+	}
+
+	attrs = append(attrs, semconv.CloudProviderGCP)
+	projectID, err := d.ProjectID()
+	add(semconv.CloudAccountIDKey, projectID, err)
+	return resource.NewSchemaless(attrs...), nil
+}
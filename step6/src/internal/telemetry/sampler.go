@@ -0,0 +1,74 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewSampler creates the sampler selected with the OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG environment variables, following the names defined
+// in the OpenTelemetry specification. The ratio of the "traceidratio" samplers
+// is read from OTEL_TRACES_SAMPLER_ARG and defaults to 1.0.
+//
+// For the demonstration, it returns the AlwaysSample sampler when
+// OTEL_TRACES_SAMPLER is not set, so that all spans are taken.
+// Do not use it in production.
+func NewSampler() (sdktrace.Sampler, error) {
+	switch s := os.Getenv("OTEL_TRACES_SAMPLER"); s {
+	case "", "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "always_off":
+		return sdktrace.NeverSample(), nil
+	case "traceidratio":
+		ratio, err := samplerRatio()
+		if err != nil {
+			return nil, err
+		}
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case "parentbased_traceidratio":
+		ratio, err := samplerRatio()
+		if err != nil {
+			return nil, err
+		}
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_SAMPLER %q", s)
+	}
+}
+
+// samplerRatio parses OTEL_TRACES_SAMPLER_ARG as the sampling ratio.
+func samplerRatio() (float64, error) {
+	v := os.Getenv("OTEL_TRACES_SAMPLER_ARG")
+	if v == "" {
+		return 1.0, nil
+	}
+	ratio, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse OTEL_TRACES_SAMPLER_ARG: %v", err)
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG must be in [0, 1], got %v", ratio)
+	}
+	return ratio, nil
+}
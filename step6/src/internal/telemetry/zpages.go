@@ -0,0 +1,55 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/zpages"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewZPages serves the zPages of the spans on ZPAGES_ADDR, e.g.
+// "localhost:8081", and returns the span processor that feeds them. The
+// /debug/tracez page shows the spans in flight and a sample of the recent
+// spans of the process, before they are exported, which helps when the
+// exporter can't reach its backend. It returns nil when ZPAGES_ADDR is not
+// set.
+func NewZPages() (sdktrace.SpanProcessor, error) {
+	addr := os.Getenv("ZPAGES_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	sp := zpages.NewSpanProcessor()
+	mux := http.NewServeMux()
+	mux.Handle("/debug/tracez", zpages.NewTracezHandler(sp))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("serving zPages", "addr", lis.Addr().String())
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to serve zPages", "error", err)
+		}
+	}()
+	return sp, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// minErrorRateRequests is the number of requests that a window needs before
+// its error rate is checked, so that a few failures of a quiet window don't
+// abort the run.
+const minErrorRateRequests = 10
+
+// errTooManyErrors is the cause of the cancellation of a run whose error rate
+// went over the maximum.
+var errTooManyErrors = errors.New("too many failed requests")
+
+// watchErrorRate checks the requests completed in every window of totals, and
+// cancels the run with errTooManyErrors when more than maxRate percent of them
+// failed, so that the loadgen doesn't keep sending requests to a broken
+// backend and flooding Cloud Trace with error spans. It returns when ctx is
+// done.
+func watchErrorRate(ctx context.Context, cancel context.CancelCauseFunc, maxRate float64, window time.Duration) {
+	t := time.NewTicker(window)
+	defer t.Stop()
+	var succeeded, failed int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		// the counts go down when totals is reset at the end of the
+		// warmup, and that window isn't checked.
+		s, f := totals.succeeded.Load(), totals.failed.Load()
+		done := s - succeeded + f - failed
+		rate := 100 * float64(f-failed) / float64(done)
+		succeeded, failed = s, f
+		if done < minErrorRateRequests || rate <= maxRate {
+			continue
+		}
+		cancel(fmt.Errorf("%w: %.1f%% of the %d requests of the last %v failed", errTooManyErrors, rate, done, window))
+		return
+	}
+}
@@ -15,11 +15,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/url"
+	"math"
 	"os"
 	"strconv"
+	"time"
 )
 
 const (
@@ -28,61 +30,375 @@ const (
 	defaultConcurrency   = 1
 	defaultRounds        = 0
 	defaultIntervalMs    = 1000
+	defaultErrorWindow   = 30 * time.Second
+	defaultDrainTimeout  = 5 * time.Second
 )
 
 var testCases = []query{
-	{"love", 3040},
-	{"friend", 1036},
-	{"hello", 349},
-	{"world", 728},
-	{"sweet", 958},
-	{"tear", 463},
-	{"faith", 484},
-	{"to be, or not to be", 1},
-	{"what's past is prologue", 1},
-	{"insolence", 14},
+	{query: "love", wantCount: 3040},
+	{query: "friend", wantCount: 1036},
+	{query: "hello", wantCount: 349},
+	{query: "world", wantCount: 728},
+	{query: "sweet", wantCount: 958},
+	{query: "tear", wantCount: 463},
+	{query: "faith", wantCount: 484},
+	{query: "to be, or not to be", wantCount: 1},
+	{query: "what's past is prologue", wantCount: 1},
+	{query: "insolence", wantCount: 14},
 }
 
-func init() {
-	clientSvcAddr := defaultClientSvcAddr
-	if os.Getenv("CLIENT_SVC_ADDR") != "" {
-		clientSvcAddr = os.Getenv("CLIENT_SVC_ADDR")
+// embeddedTestCases are the expected counts when the server falls back to the
+// small corpus embedded in its binary.
+var embeddedTestCases = []query{
+	{query: "love", wantCount: 5},
+	{query: "friend", wantCount: 2},
+	{query: "sweet", wantCount: 3},
+	{query: "faith", wantCount: 1},
+	{query: "sleep", wantCount: 6},
+	{query: "romeo", wantCount: 8},
+	{query: "brutus", wantCount: 9},
+	{query: "to be, or not to be", wantCount: 1},
+	{query: "what's past is prologue", wantCount: 1},
+	{query: "insolence", wantCount: 1},
+}
+
+// config is the configuration of the loadgen.
+type config struct {
+	// targets is the clients and the percentage of the requests sent to
+	// each of them.
+	targets targets
+	// server is the address of the server, whose RPCs are called directly
+	// instead of the client when it isn't "".
+	server string
+	// workers is the number of requests of every round, of which concurrency
+	// are in flight at once.
+	workers     int
+	concurrency int
+	// rounds is the number of rounds, or 0 to run until the loadgen is
+	// stopped. The rounds start every interval.
+	rounds   int
+	interval time.Duration
+	// duration is the time after which the loadgen stops, or 0 to run
+	// until the rounds are done or the loadgen is stopped.
+	duration time.Duration
+	// readyTimeout is the time given to the targets to be ready before the
+	// run, or 0 to start the run right away.
+	readyTimeout time.Duration
+	// drainTimeout is the time given to the requests in flight to complete
+	// when the run stops, before they are canceled.
+	drainTimeout time.Duration
+	// warmup and warmupRounds are the time and the number of rounds of the
+	// warmup before the run, or 0. warmupTraces is false to drop the traces
+	// of the warmup.
+	warmup       time.Duration
+	warmupRounds int
+	warmupTraces bool
+	// batch makes every worker send all the test cases in a single request.
+	batch bool
+	// load is the rate of the requests of the open loop over time, which
+	// replaces the workers when it isn't nil.
+	load loadProfile
+	// arrivals is "constant" or "poisson", the process of the arrivals of
+	// the requests of the open loop.
+	arrivals string
+	// scenario is the queries sent by the workers and their expected
+	// counts.
+	scenario scenario
+	// maxErrorRate is the percentage of the requests of an errorWindow over
+	// which the run is aborted, or 0 to never abort it.
+	maxErrorRate float64
+	errorWindow  time.Duration
+	// resultsFile is the path of the file where the results of the run are
+	// written at exit, or "".
+	resultsFile string
+	// histogramFile is the path of the file where the histogram of the
+	// latency of the run is written at exit, or "".
+	histogramFile string
+	// slowRequest is the latency over which the trace of a request is
+	// logged, like the traces of the failed requests, or 0.
+	slowRequest time.Duration
+	// roundSpans makes the requests of every round the children of a
+	// loadgen.round span, linked to a loadgen.run span.
+	roundSpans bool
+	// sampleRatio is the ratio of the traces sampled by the loadgen, or nil
+	// to use the sampler of OTEL_TRACES_SAMPLER.
+	sampleRatio *float64
+	// transport is the tuning of the connections to the client.
+	transport transportConfig
+	// retry is the retry policy of the requests that fail with a transient
+	// error.
+	retry retryPolicy
+}
+
+// parseConfig parses the command-line flags in args. The environment variables
+// read with getenv, which the manifests set, are the defaults of the flags.
+// It returns flag.ErrHelp when args has -h or -help.
+func parseConfig(args []string, getenv func(string) string) (config, error) {
+	target := defaultClientSvcAddr
+	if v := getenv("CLIENT_SVC_ADDR"); v != "" {
+		target = v
 	}
-	var err error
-	reqURL, err = url.Parse(fmt.Sprintf("http://" + clientSvcAddr))
-	if err != nil {
-		log.Fatalf("failed to build request URL for %v: %v", clientSvcAddr, err)
+	cfg := config{
+		workers:      defaultWorkers,
+		concurrency:  defaultConcurrency,
+		rounds:       defaultRounds,
+		interval:     defaultIntervalMs * time.Millisecond,
+		errorWindow:  defaultErrorWindow,
+		drainTimeout: defaultDrainTimeout,
+		readyTimeout: defaultReadyTimeout,
+		warmupTraces: true,
+		transport:    defaultTransportConfig(),
+		retry: retryPolicy{
+			maxAttempts:    1,
+			initialBackoff: defaultRetryInitialBackoff,
+			maxBackoff:     defaultRetryMaxBackoff,
+		},
+	}
+	ints := []struct {
+		key    string
+		target *int
+	}{
+		{"NUM_WORKERS", &cfg.workers},
+		{"NUM_CONCURRENCY", &cfg.concurrency},
+		{"NUM_ROUNDS", &cfg.rounds},
+		{"WARMUP_ROUNDS", &cfg.warmupRounds},
+		{"HTTP_MAX_IDLE_CONNS_PER_HOST", &cfg.transport.maxIdleConnsPerHost},
+		{"HTTP_MAX_CONNS_PER_HOST", &cfg.transport.maxConnsPerHost},
+		{"MAX_ATTEMPTS", &cfg.retry.maxAttempts},
 	}
-	numWorkers = defaultWorkers
-	if os.Getenv("NUM_WORKERS") != "" {
-		w, err := strconv.ParseInt(os.Getenv("NUM_WORKERS"), 10, 64)
+	for _, e := range ints {
+		if v := getenv(e.key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return config{}, fmt.Errorf("%s must be an integer, got %q", e.key, v)
+			}
+			*e.target = n
+		}
+	}
+	if v := getenv("INTERVAL_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
 		if err != nil {
-			log.Fatalf("failed to parse NUM_WORKERS: %v", err)
+			return config{}, fmt.Errorf("INTERVAL_MS must be an integer, got %q", v)
 		}
-		numWorkers = int(w)
+		cfg.interval = time.Duration(ms) * time.Millisecond
+	}
+	durations := []struct {
+		key    string
+		target *time.Duration
+	}{
+		{"RUN_DURATION", &cfg.duration},
+		{"DRAIN_TIMEOUT", &cfg.drainTimeout},
+		{"READY_TIMEOUT", &cfg.readyTimeout},
+		{"WARMUP_DURATION", &cfg.warmup},
+		{"ERROR_WINDOW", &cfg.errorWindow},
+		{"SLOW_REQUEST_THRESHOLD", &cfg.slowRequest},
+		{"HTTP_DIAL_TIMEOUT", &cfg.transport.dialTimeout},
+		{"HTTP_TLS_HANDSHAKE_TIMEOUT", &cfg.transport.tlsHandshakeTimeout},
+		{"HTTP_KEEP_ALIVE", &cfg.transport.keepAlive},
+		{"HTTP_IDLE_CONN_TIMEOUT", &cfg.transport.idleConnTimeout},
+		{"RETRY_INITIAL_BACKOFF", &cfg.retry.initialBackoff},
+		{"RETRY_MAX_BACKOFF", &cfg.retry.maxBackoff},
 	}
-	numConcurrency = defaultConcurrency
-	if os.Getenv("NUM_CONCURRENCY") != "" {
-		c, err := strconv.ParseInt(os.Getenv("NUM_CONCURRENCY"), 10, 64)
+	for _, e := range durations {
+		if v := getenv(e.key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return config{}, fmt.Errorf("%s must be a duration, got %q", e.key, v)
+			}
+			*e.target = d
+		}
+	}
+	bools := []struct {
+		key    string
+		target *bool
+	}{
+		{"WARMUP_TRACES", &cfg.warmupTraces},
+		{"BATCH", &cfg.batch},
+		{"ROUND_SPANS", &cfg.roundSpans},
+		{"HTTP_DISABLE_KEEP_ALIVES", &cfg.transport.disableKeepAlives},
+	}
+	for _, e := range bools {
+		if v := getenv(e.key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return config{}, fmt.Errorf("%s must be a boolean, got %q", e.key, v)
+			}
+			*e.target = b
+		}
+	}
+	var qps float64
+	if v := getenv("TARGET_QPS"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Fatalf("failed to parse NUM_CONCURRENCY: %v", err)
+			return config{}, fmt.Errorf("TARGET_QPS must be a number, got %q", v)
 		}
-		numConcurrency = int(c)
+		qps = n
 	}
-	numRounds = defaultRounds
-	if os.Getenv("NUM_ROUNDS") != "" {
-		r, err := strconv.ParseInt(os.Getenv("NUM_ROUNDS"), 10, 64)
+	if v := getenv("MAX_ERROR_RATE"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Fatalf("failed to parse NUM_ROUNDS: %v", err)
+			return config{}, fmt.Errorf("MAX_ERROR_RATE must be a number, got %q", v)
 		}
-		numRounds = int(r)
+		cfg.maxErrorRate = n
 	}
-	intervalMs = defaultIntervalMs
-	if os.Getenv("INTERVAL_MS") != "" {
-		i, err := strconv.ParseInt(os.Getenv("INTERVAL_MS"), 10, 64)
+	if v := getenv("LOADGEN_SAMPLE_RATIO"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Fatalf("failed to parse INTERVAL_MS: %v", err)
+			return config{}, fmt.Errorf("LOADGEN_SAMPLE_RATIO must be a number, got %q", v)
 		}
-		intervalMs = int(i)
+		cfg.sampleRatio = &r
+	}
+	profile := getenv("LOAD_PROFILE")
+	cfg.arrivals = "constant"
+	if v := getenv("ARRIVALS"); v != "" {
+		cfg.arrivals = v
+	}
+	corpus := getenv("CORPUS")
+	tol := getenv("COUNT_TOLERANCE")
+	cfg.server = getenv("SERVER_SVC_ADDR")
+	scenarioFile := getenv("SCENARIO_FILE")
+	cfg.histogramFile = getenv("HISTOGRAM_FILE")
+	cfg.resultsFile = getenv("RESULTS_FILE")
+
+	fs := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	fs.StringVar(&target, "target", target, "`address` of the client, or comma-separated addresses each followed by =PERCENT of the requests, e.g. clientservice:8080=90,clientservice-canary:8080=10 (CLIENT_SVC_ADDR)")
+	fs.StringVar(&cfg.server, "server", cfg.server, "`address` of the server, to call its GetMatchCount RPC directly instead of the client, or its GetMatchCounts RPC with -batch (SERVER_SVC_ADDR)")
+	fs.IntVar(&cfg.workers, "workers", cfg.workers, "number of requests of every round (NUM_WORKERS)")
+	fs.IntVar(&cfg.concurrency, "concurrency", cfg.concurrency, "number of requests of a round in flight at once (NUM_CONCURRENCY)")
+	fs.IntVar(&cfg.rounds, "rounds", cfg.rounds, "number of rounds, or 0 to run until stopped (NUM_ROUNDS)")
+	fs.DurationVar(&cfg.interval, "interval", cfg.interval, "time between the starts of the rounds, or between the reports of the open loop (INTERVAL_MS, in milliseconds)")
+	fs.DurationVar(&cfg.duration, "duration", cfg.duration, "stop after this time, or 0 to run until the rounds are done or the loadgen is stopped (RUN_DURATION)")
+	fs.DurationVar(&cfg.drainTimeout, "drain-timeout", cfg.drainTimeout, "time given to the requests in flight to complete when the run stops, before they are canceled (DRAIN_TIMEOUT)")
+	fs.DurationVar(&cfg.readyTimeout, "ready-timeout", cfg.readyTimeout, "wait up to this time for /readyz of the clients, or the health of the server with -server, to report them ready before the run, or 0 to not wait (READY_TIMEOUT)")
+	fs.DurationVar(&cfg.warmup, "warmup", cfg.warmup, "send requests for this time before the run, and leave them out of its summary (WARMUP_DURATION)")
+	fs.IntVar(&cfg.warmupRounds, "warmup-rounds", cfg.warmupRounds, "like -warmup, for this number of rounds (WARMUP_ROUNDS)")
+	fs.BoolVar(&cfg.warmupTraces, "warmup-traces", cfg.warmupTraces, "set to false to drop the traces of the requests of the warmup (WARMUP_TRACES)")
+	fs.Float64Var(&qps, "qps", qps, "send this many requests per second whatever their latency, instead of the rounds of workers (TARGET_QPS)")
+	fs.StringVar(&profile, "profile", profile, "like -qps, with a rate that changes over time: ramp:FROM-TO/DURATION or steps:QPS,QPS,.../DURATION (LOAD_PROFILE)")
+	fs.StringVar(&cfg.arrivals, "arrivals", cfg.arrivals, "arrivals of the requests of -qps and -profile: constant, or poisson for random times between the requests (ARRIVALS)")
+	fs.Float64Var(&cfg.maxErrorRate, "max-error-rate", cfg.maxErrorRate, "abort the run with exit code 1 when more than this percentage of the requests of an -error-window fail, or 0 to never abort it (MAX_ERROR_RATE)")
+	fs.DurationVar(&cfg.errorWindow, "error-window", cfg.errorWindow, "window of the requests whose error rate is checked against -max-error-rate (ERROR_WINDOW)")
+	fs.BoolVar(&cfg.batch, "batch", cfg.batch, "send all the test cases of a worker in a single request to /batch (BATCH)")
+	fs.IntVar(&cfg.transport.maxIdleConnsPerHost, "max-idle-conns-per-host", cfg.transport.maxIdleConnsPerHost, "number of idle connections to the client kept for the next requests (HTTP_MAX_IDLE_CONNS_PER_HOST)")
+	fs.IntVar(&cfg.transport.maxConnsPerHost, "max-conns-per-host", cfg.transport.maxConnsPerHost, "number of connections to the client, or 0 for no limit (HTTP_MAX_CONNS_PER_HOST)")
+	fs.DurationVar(&cfg.transport.dialTimeout, "dial-timeout", cfg.transport.dialTimeout, "timeout of the connection to the client (HTTP_DIAL_TIMEOUT)")
+	fs.DurationVar(&cfg.transport.tlsHandshakeTimeout, "tls-handshake-timeout", cfg.transport.tlsHandshakeTimeout, "timeout of the TLS handshake with the client (HTTP_TLS_HANDSHAKE_TIMEOUT)")
+	fs.DurationVar(&cfg.transport.keepAlive, "keep-alive", cfg.transport.keepAlive, "interval of the TCP keep-alive probes of the connections to the client, or a negative duration to disable them (HTTP_KEEP_ALIVE)")
+	fs.DurationVar(&cfg.transport.idleConnTimeout, "idle-conn-timeout", cfg.transport.idleConnTimeout, "time after which the idle connections to the client are closed, or 0 for never (HTTP_IDLE_CONN_TIMEOUT)")
+	fs.BoolVar(&cfg.transport.disableKeepAlives, "disable-keep-alives", cfg.transport.disableKeepAlives, "open a new connection to the client for every request (HTTP_DISABLE_KEEP_ALIVES)")
+	fs.IntVar(&cfg.retry.maxAttempts, "max-attempts", cfg.retry.maxAttempts, "number of attempts of the requests that fail with a refused connection, a 5xx response or an UNAVAILABLE error, 1 for no retries (MAX_ATTEMPTS)")
+	fs.DurationVar(&cfg.retry.initialBackoff, "retry-initial-backoff", cfg.retry.initialBackoff, "maximum pause before the first retry of a request, doubled on every retry up to -retry-max-backoff, the pauses being random (RETRY_INITIAL_BACKOFF)")
+	fs.DurationVar(&cfg.retry.maxBackoff, "retry-max-backoff", cfg.retry.maxBackoff, "maximum pause between two attempts of a request (RETRY_MAX_BACKOFF)")
+	fs.DurationVar(&cfg.slowRequest, "slow-request", cfg.slowRequest, "log the trace of the requests slower than this, like the traces of the failed requests, or 0 to only log the failed requests (SLOW_REQUEST_THRESHOLD)")
+	fs.BoolVar(&cfg.roundSpans, "round-spans", cfg.roundSpans, "trace every round, or every -interval of -qps and -profile, with a loadgen.round span, parent of the spans of its requests and linked to a loadgen.run span (ROUND_SPANS)")
+	fs.Func("sample-ratio", "sample this `ratio` of the traces, from 0 to 1, instead of using the sampler of OTEL_TRACES_SAMPLER (LOADGEN_SAMPLE_RATIO)", func(v string) error {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		cfg.sampleRatio = &r
+		return nil
+	})
+	fs.StringVar(&tol, "tolerance", tol, "accept the counts within this number of lines, or percentage ending with %, of the expected counts (COUNT_TOLERANCE)")
+	fs.StringVar(&corpus, "corpus", corpus, "set to embedded to expect the counts of the corpus embedded in the server (CORPUS)")
+	fs.StringVar(&scenarioFile, "scenario", scenarioFile, "YAML or JSON `file` of the queries, their expected counts and weights, instead of the built-in test cases (SCENARIO_FILE)")
+	fs.StringVar(&cfg.resultsFile, "results", cfg.resultsFile, "write the results of the run to `file` at exit, in CSV when it ends with .csv and in JSON otherwise (RESULTS_FILE)")
+	fs.StringVar(&cfg.histogramFile, "histogram", cfg.histogramFile, "write the HdrHistogram percentile distribution of the latency of the run to `file` at exit (HISTOGRAM_FILE)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: loadgen [flags]\n\nloadgen sends the test queries to the client, or to the server, in rounds and checks their counts.\nThe flags default to the environment variables in parentheses.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	if fs.NArg() > 0 {
+		return config{}, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	switch {
+	case cfg.workers <= 0:
+		return config{}, fmt.Errorf("the number of workers must be positive, got %d", cfg.workers)
+	case cfg.concurrency <= 0:
+		return config{}, fmt.Errorf("the concurrency must be positive, got %d", cfg.concurrency)
+	case cfg.rounds < 0:
+		return config{}, fmt.Errorf("the number of rounds can't be negative, got %d", cfg.rounds)
+	case cfg.interval <= 0:
+		return config{}, fmt.Errorf("the interval must be positive, got %v", cfg.interval)
+	case cfg.duration < 0:
+		return config{}, fmt.Errorf("the duration can't be negative, got %v", cfg.duration)
+	case cfg.slowRequest < 0:
+		return config{}, fmt.Errorf("the slow request threshold can't be negative, got %v", cfg.slowRequest)
+	case cfg.drainTimeout < 0:
+		return config{}, fmt.Errorf("the drain timeout can't be negative, got %v", cfg.drainTimeout)
+	case cfg.readyTimeout < 0:
+		return config{}, fmt.Errorf("the ready timeout can't be negative, got %v", cfg.readyTimeout)
+	case cfg.warmup < 0:
+		return config{}, fmt.Errorf("the warmup duration can't be negative, got %v", cfg.warmup)
+	case cfg.warmupRounds < 0:
+		return config{}, fmt.Errorf("the number of warmup rounds can't be negative, got %d", cfg.warmupRounds)
+	case cfg.warmupRounds > 0 && (qps > 0 || profile != ""):
+		return config{}, errors.New("the warmup of the target QPS and the load profile is a duration, not a number of rounds")
+	case qps < 0 || math.IsInf(qps, 0) || math.IsNaN(qps):
+		return config{}, fmt.Errorf("the target QPS must be 0 or a positive number, got %v", qps)
+	case qps > 0 && profile != "":
+		return config{}, errors.New("the target QPS and the load profile can't be set together")
+	case cfg.transport.maxIdleConnsPerHost < 0 || cfg.transport.maxConnsPerHost < 0:
+		return config{}, errors.New("the numbers of connections to the client can't be negative")
+	case cfg.transport.dialTimeout < 0 || cfg.transport.tlsHandshakeTimeout < 0 || cfg.transport.idleConnTimeout < 0:
+		return config{}, errors.New("the timeouts of the connections to the client can't be negative")
+	case cfg.retry.maxAttempts <= 0:
+		return config{}, fmt.Errorf("the number of attempts must be positive, got %d", cfg.retry.maxAttempts)
+	case cfg.retry.initialBackoff <= 0 || cfg.retry.maxBackoff < cfg.retry.initialBackoff:
+		return config{}, fmt.Errorf("the retry backoffs must be positive, and the maximum backoff at least the initial one, got %v and %v", cfg.retry.initialBackoff, cfg.retry.maxBackoff)
+	case cfg.sampleRatio != nil && !(*cfg.sampleRatio >= 0 && *cfg.sampleRatio <= 1):
+		return config{}, fmt.Errorf("the sample ratio must be from 0 to 1, got %v", *cfg.sampleRatio)
+	case cfg.maxErrorRate < 0 || cfg.maxErrorRate >= 100 || math.IsNaN(cfg.maxErrorRate):
+		return config{}, fmt.Errorf("the maximum error rate must be a percentage from 0 up to 100, got %v", cfg.maxErrorRate)
+	case cfg.errorWindow <= 0:
+		return config{}, fmt.Errorf("the error window must be positive, got %v", cfg.errorWindow)
+	case cfg.arrivals != "constant" && cfg.arrivals != "poisson":
+		return config{}, fmt.Errorf("the arrivals must be constant or poisson, got %q", cfg.arrivals)
+	}
+	var err error
+	if profile != "" {
+		if cfg.load, err = parseLoadProfile(profile); err != nil {
+			return config{}, err
+		}
+	} else if qps > 0 {
+		cfg.load = constantLoad(qps)
+	}
+	if cfg.targets, err = parseTargets(target); err != nil {
+		return config{}, err
+	}
+	var t tolerance
+	if tol != "" {
+		if t, err = parseTolerance(tol); err != nil {
+			return config{}, err
+		}
+	}
+	switch {
+	case scenarioFile != "":
+		if cfg.scenario, err = loadScenario(scenarioFile, t); err != nil {
+			return config{}, err
+		}
+	case corpus == "embedded":
+		cfg.scenario = newScenario(withTolerance(embeddedTestCases, t))
+	default:
+		cfg.scenario = newScenario(withTolerance(testCases, t))
+	}
+	return cfg, nil
+}
+
+// mustParseConfig parses the configuration of the loadgen from the
+// command-line and the environment. It exits after printing the usage for
+// -help, and on invalid flags or variables.
+func mustParseConfig() config {
+	cfg, err := parseConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fatal("invalid configuration", "error", err)
 	}
+	return cfg
 }
@@ -0,0 +1,98 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tolerance is the difference from the expected count of a query that is
+// accepted in the counts, in lines or in percent of the expected count, so
+// that the expected counts don't all break when the corpus or the matching
+// mode of the server changes a little.
+type tolerance struct {
+	lines   int
+	percent float64
+}
+
+// parseTolerance parses a tolerance in lines, e.g. "10", or in percent of the
+// expected count, e.g. "5%". It may start with "±" or "+-".
+func parseTolerance(s string) (tolerance, error) {
+	v := strings.TrimSpace(s)
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "±"), "+-")
+	if p, ok := strings.CutSuffix(v, "%"); ok {
+		percent, err := strconv.ParseFloat(p, 64)
+		if err != nil || !(percent >= 0 && percent <= 100) {
+			return tolerance{}, fmt.Errorf("invalid tolerance %q: the percentage must be from 0 to 100", s)
+		}
+		return tolerance{percent: percent}, nil
+	}
+	lines, err := strconv.Atoi(v)
+	if err != nil || lines < 0 {
+		return tolerance{}, fmt.Errorf("invalid tolerance %q: must be a number of lines, or a percentage ending with %%", s)
+	}
+	return tolerance{lines: lines}, nil
+}
+
+// allows returns whether got is within t of want.
+func (t tolerance) allows(want, got int) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	if t.percent > 0 {
+		return float64(diff) <= float64(want)*t.percent/100
+	}
+	return diff <= t.lines
+}
+
+func (t tolerance) String() string {
+	switch {
+	case t.percent > 0:
+		return "±" + strconv.FormatFloat(t.percent, 'f', -1, 64) + "%"
+	case t.lines > 0:
+		return "±" + strconv.Itoa(t.lines)
+	default:
+		return ""
+	}
+}
+
+// expected returns whether matched is an expected count of q.
+func (q query) expected(matched int) bool {
+	if q.pattern != nil {
+		return q.pattern.MatchString(strconv.Itoa(matched))
+	}
+	return q.tolerance.allows(q.wantCount, matched)
+}
+
+// want describes the expected counts of q for the logs.
+func (q query) want() string {
+	if q.pattern != nil {
+		return "/" + q.pattern.String() + "/"
+	}
+	return strconv.Itoa(q.wantCount) + q.tolerance.String()
+}
+
+// withTolerance returns a copy of qs whose counts are accepted within t.
+func withTolerance(qs []query, t tolerance) []query {
+	out := make([]query, len(qs))
+	for i, q := range qs {
+		q.tolerance = t
+		out[i] = q
+	}
+	return out
+}
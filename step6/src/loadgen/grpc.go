@@ -0,0 +1,128 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"opentelemetry-trace-codelab-go/loadgen/shakesapp"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+)
+
+// serverClient calls the server directly, bypassing the client, when the
+// address of the server is set. It is nil otherwise.
+var serverClient shakesapp.ShakespeareServiceClient
+
+// serverHealth checks the health of the server when serverClient isn't nil.
+var serverHealth healthpb.HealthClient
+
+// newServerConn creates the connection to the server at addr, instrumented
+// with otelgrpc like the connection of the client, so that the spans of the
+// RPCs are the children of the spans of the loadgen. The health checks are
+// left out of the traces. The bearer token in AUTH_TOKEN is sent with every
+// RPC, as the client does.
+func newServerConn(addr string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithTracerProvider(otel.GetTracerProvider()),
+			otelgrpc.WithFilter(func(info *stats.RPCTagInfo) bool {
+				return !strings.HasPrefix(info.FullMethodName, healthMethodPrefix)
+			}),
+		)),
+	}
+	if token := os.Getenv("AUTH_TOKEN"); token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(token)))
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the client of the server at %s: %v", addr, err)
+	}
+	return conn, nil
+}
+
+// tokenCredentials attaches the bearer token that the server requires when
+// AUTH_TOKEN is set to the metadata of every RPC.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity allows the token on the plaintext connection of the
+// codelab.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// runRPC sends a query s to the GetMatchCount RPC of the server and returns
+// the number of matched lines.
+func runRPC(ctx context.Context, s string) (matched int, err error) {
+	tr := otel.Tracer("loadgen")
+	ctx, span := tr.Start(ctx, "query.request", trace.WithAttributes(
+		attribute.Key("query").String(s),
+	))
+	defer func() { endSpan(span, err) }()
+	var resp *shakesapp.ShakespeareResponse
+	err = retry.do(ctx, func() error {
+		resp, err = serverClient.GetMatchCount(ctx, &shakesapp.ShakespeareRequest{Query: s})
+		return err
+	})
+	if err != nil {
+		return -1, fmt.Errorf("error calling GetMatchCount: %w", err)
+	}
+	return int(resp.MatchCount), nil
+}
+
+// runBatchRPC sends all the queries qs to the GetMatchCounts RPC of the server
+// and returns the number of matched lines of each of them.
+func runBatchRPC(ctx context.Context, qs []query) (counts []int, err error) {
+	tr := otel.Tracer("loadgen")
+	ctx, span := tr.Start(ctx, "query.batch", trace.WithAttributes(
+		attribute.Key("queries").Int(len(qs)),
+	))
+	defer func() { endSpan(span, err) }()
+	req := &shakesapp.BatchShakespeareRequest{}
+	for _, q := range qs {
+		req.Queries = append(req.Queries, q.query)
+	}
+	var resp *shakesapp.BatchShakespeareResponse
+	err = retry.do(ctx, func() error {
+		resp, err = serverClient.GetMatchCounts(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling GetMatchCounts: %w", err)
+	}
+	if len(resp.MatchCounts) != len(qs) {
+		return nil, fmt.Errorf("got %d counts for %d queries", len(resp.MatchCounts), len(qs))
+	}
+	counts = make([]int, len(qs))
+	for i, n := range resp.MatchCounts {
+		counts[i] = int(n)
+	}
+	return counts, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+const (
+	// maxLatency is the highest latency that the histograms record. The
+	// higher latencies are recorded as maxLatency.
+	maxLatency = 10 * time.Minute
+	// latencySignificantFigures is the precision of the histograms: the
+	// latencies are recorded within 0.1% of their value.
+	latencySignificantFigures = 3
+)
+
+// latencies records the latency of the requests of the loadgen.
+var latencies = newLatencyRecorder()
+
+// latencyRecorder keeps the latency of the requests of the current round, or
+// of the current interval of the open loop, and of the whole run, in HDR
+// histograms of microseconds. Unlike a list of the latencies, the histograms
+// have a fixed size whatever the length of the run, and unlike the buckets of
+// a metric, they keep the tail of the latency accurate.
+type latencyRecorder struct {
+	mu    sync.Mutex
+	round *hdrhistogram.Histogram
+	run   *hdrhistogram.Histogram
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{
+		round: newLatencyHistogram(),
+		run:   newLatencyHistogram(),
+	}
+}
+
+func newLatencyHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, maxLatency.Microseconds(), latencySignificantFigures)
+}
+
+// record records the latency d of a request.
+func (r *latencyRecorder) record(d time.Duration) {
+	us := min(max(d.Microseconds(), 1), maxLatency.Microseconds())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// the value is within the range of the histograms.
+	r.round.RecordValue(us)
+	r.run.RecordValue(us)
+}
+
+// takeRound returns the summary of the latency of the requests recorded since
+// the last call, and starts a new round.
+func (r *latencyRecorder) takeRound() latencySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := summarize(r.round)
+	r.round.Reset()
+	return s
+}
+
+// total returns the summary of the latency of all the requests of the run.
+func (r *latencyRecorder) total() latencySummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return summarize(r.run)
+}
+
+// reset discards the latencies recorded so far.
+func (r *latencyRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.round.Reset()
+	r.run.Reset()
+}
+
+// writeFile writes the histogram of the latency of the whole run to the file
+// at path, in the percentile distribution format of HdrHistogram, in
+// milliseconds. The files of two runs can be compared with the plotter of
+// HdrHistogram, https://hdrhistogram.github.io/HdrHistogram/plotFiles.html.
+func (r *latencyRecorder) writeFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	_, err = r.run.PercentilesPrint(f, 5, float64(time.Millisecond/time.Microsecond))
+	r.mu.Unlock()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// latencySummary is the distribution of the latency of a set of requests.
+type latencySummary struct {
+	count                             int64
+	mean, p50, p90, p95, p99, maximum time.Duration
+}
+
+// summarize returns the summary of the histogram h of microseconds.
+func summarize(h *hdrhistogram.Histogram) latencySummary {
+	us := func(v int64) time.Duration { return time.Duration(v) * time.Microsecond }
+	return latencySummary{
+		count:   h.TotalCount(),
+		mean:    time.Duration(h.Mean() * float64(time.Microsecond)),
+		p50:     us(h.ValueAtQuantile(50)),
+		p90:     us(h.ValueAtQuantile(90)),
+		p95:     us(h.ValueAtQuantile(95)),
+		p99:     us(h.ValueAtQuantile(99)),
+		maximum: us(h.Max()),
+	}
+}
+
+// attr returns s as the latency_ms attribute of a log record, in
+// milliseconds.
+func (s latencySummary) attr() slog.Attr {
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return slog.Group("latency_ms",
+		"p50", ms(s.p50),
+		"p90", ms(s.p90),
+		"p95", ms(s.p95),
+		"p99", ms(s.p99),
+		"mean", ms(s.mean),
+		"max", ms(s.maximum),
+	)
+}
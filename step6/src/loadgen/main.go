@@ -17,158 +17,363 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
 	"time"
 
-	cloudtrace "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+	"opentelemetry-trace-codelab-go/loadgen/shakesapp"
+
 	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
 	"go.opentelemetry.io/otel/trace"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-var (
-	reqURL *url.URL
-
-	// All configuration numbers can be tweaked via manifest file
-	numWorkers     int
-	numConcurrency int
-	numRounds      int
-	intervalMs     int
+const (
+	serviceName    = "loadgen"
+	serviceVersion = "1.0.0"
+)
 
-	// step1. setup customized HTTP client
-	httpClient = http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+var (
+	// step1. setup customized HTTP client. Its transport, instrumented with
+	// otelhttp, is tuned with the configuration in main.
+	httpClient http.Client
 )
 
 type query struct {
 	query     string
 	wantCount int
+	// tolerance is the difference from wantCount accepted in the counts.
+	tolerance tolerance
+	// pattern, when it isn't nil, is matched against the counts in decimal
+	// instead of wantCount.
+	pattern *regexp.Regexp
 }
 
 // step1. add OpenTelemetry initialization function
-func initTracer() (*sdktrace.TracerProvider, error) {
-	// step3. replace stdout exporter with Cloud Trace exporter
-	// cloudtrace.New() finds the credentials to Cloud Trace automatically following the
-	// rules defined by golang.org/x/oauth2/google.findDefaultCredentailsWithParams.
-	// https://pkg.go.dev/golang.org/x/oauth2/google#FindDefaultCredentialsWithParams
-	exporter, err := cloudtrace.New()
-	// step3. end replacing exporter
+func initTracer(cfg config) (*sdktrace.TracerProvider, error) {
+	exporter, err := telemetry.NewExporter(context.Background())
 	if err != nil {
 		return nil, err
 	}
 
-	// for the demonstration, we use AlwaysSmaple sampler to take all spans.
-	// do not use this option in production.
+	// for the demonstration, NewSampler returns AlwaysSample sampler to take all
+	// spans unless OTEL_TRACES_SAMPLER is set. The loadgen starts the traces,
+	// so that its ratio sampler decides which traces the ParentBased samplers
+	// of the client and the server sample.
+	var sampler sdktrace.Sampler
+	if cfg.sampleRatio != nil {
+		sampler = sdktrace.TraceIDRatioBased(*cfg.sampleRatio)
+	} else if sampler, err = telemetry.NewSampler(); err != nil {
+		return nil, err
+	}
+	if !cfg.warmupTraces {
+		sampler = warmupSampler{sampler}
+	}
+	limits, err := telemetry.NewSpanLimits()
+	if err != nil {
+		return nil, err
+	}
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	prop, err := telemetry.NewPropagator()
+	if err != nil {
+		return nil, err
+	}
+	batcher, err := telemetry.NewBatchSpanProcessor(exporter)
+	if err != nil {
+		return nil, err
+	}
+	// hash the raw queries before they are exported.
+	redaction, err := telemetry.NewRedactionProcessor(batcher)
+	if err != nil {
+		return nil, err
+	}
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithRawSpanLimits(limits),
+		sdktrace.WithSpanProcessor(redaction),
+		// log the trace of the failed and slow requests.
+		sdktrace.WithSpanProcessor(newRequestLogger(cfg.slowRequest)),
 	)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTextMapPropagator(prop)
 	return tp, nil
 }
 
+// initLogger creates the LoggerProvider that exports the log records of the
+// loadgen next to its spans.
+func initLogger() (*sdklog.LoggerProvider, error) {
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return telemetry.NewLoggerProvider(context.Background(), res)
+}
+
 func main() {
+	// the exit code is set by the run, and the loadgen exits with it after the
+	// deferred shutdowns.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+	slog.SetDefault(telemetry.NewLogger(serviceName, nil))
+	// All configuration numbers can be tweaked via flags or manifest file
+	cfg := mustParseConfig()
+	httpClient.Transport = otelhttp.NewTransport(newHTTPTransport(cfg.transport))
+	retry = cfg.retry
+	// size the Go runtime to the container before the resources are created,
+	// so that they carry its memory limit.
+	slog.Info("configured the Go runtime",
+		"gomaxprocs", telemetry.SetMaxProcs(),
+		"gomemlimit", telemetry.SetMemoryLimit(),
+	)
+
+	lp, err := initLogger()
+	if err != nil {
+		fatal("failed to initialize LoggerProvider", "error", err)
+	}
+	defer func() {
+		if err := lp.Shutdown(context.Background()); err != nil {
+			fatal("failed to shut down LoggerProvider", "error", err)
+		}
+	}()
+	slog.SetDefault(telemetry.NewLogger(serviceName, lp))
+
 	// step1. setup OpenTelemetry
-	tp, err := initTracer()
+	tp, err := initTracer(cfg)
 	if err != nil {
-		log.Fatalf("failed to initialize TracerProvider: %v", err)
+		fatal("failed to initialize TracerProvider", "error", err)
 	}
 	defer func() {
 		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down TracerProvider: %v", err)
+			fatal("failed to shut down TracerProvider", "error", err)
 		}
 	}()
 	// step1. end setup
 
-	log.Printf("starting worder with %d workers in %d concurrency", numWorkers, numConcurrency)
-	log.Printf("number of rounds: %d (0 is inifinite)", numRounds)
+	if cfg.server != "" {
+		conn, err := newServerConn(cfg.server)
+		if err != nil {
+			fatal("failed to connect to the server", "error", err)
+		}
+		defer conn.Close()
+		serverClient = shakesapp.NewShakespeareServiceClient(conn)
+		serverHealth = healthpb.NewHealthClient(conn)
+		slog.Info("calling the server directly", "server", cfg.server)
+	} else {
+		slog.Info("sending the requests to the client", "targets", cfg.targets.String())
+	}
 
-	t := time.NewTicker(time.Duration(intervalMs) * time.Millisecond)
-	i := 0
-	for range t.C {
-		log.Printf("simulating client requests, round %d", i)
-		if err := run(numWorkers, numConcurrency); err != nil {
-			log.Printf("aborted round with error: %v", err)
+	// the run ends at its deadline, when the loadgen is stopped, or when too
+	// many requests fail. No request is sent after that, and the requests in
+	// flight get cfg.drainTimeout to complete before they are canceled. The
+	// deferred shutdowns then flush their spans and logs.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	if cfg.maxErrorRate > 0 {
+		go watchErrorRate(ctx, abort, cfg.maxErrorRate, cfg.errorWindow)
+	}
+	if cfg.readyTimeout > 0 {
+		if err := waitForReady(ctx, cfg); err != nil {
+			if ctx.Err() != nil {
+				slog.Info("stopped while waiting for the targets to be ready")
+				return
+			}
+			slog.Error("the targets aren't ready", "timeout", cfg.readyTimeout.String(), "error", err)
+			exitCode = 1
+			return
 		}
-		log.Printf("simulated %d requests", numWorkers)
-		if numRounds != 0 && i > numRounds {
-			break
+	}
+	if cfg.warmup > 0 || cfg.warmupRounds > 0 {
+		warmUp(ctx, cfg)
+	}
+	if cfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.duration)
+		defer cancel()
+	}
+	reqCtx, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+	stopDrain := context.AfterFunc(ctx, func() {
+		// a second SIGINT or SIGTERM exits at once.
+		stop()
+		slog.Info("stopping, waiting for the requests in flight", "timeout", cfg.drainTimeout.String())
+		time.AfterFunc(cfg.drainTimeout, cancelRequests)
+	})
+	defer stopDrain()
+	if cfg.roundSpans {
+		var span trace.Span
+		ctx, span = startRunSpan(ctx, cfg)
+		defer span.End()
+	}
+	start := time.Now()
+	if cfg.load != nil {
+		slog.Info("starting open loop", "target_qps", cfg.load(0), "arrivals", cfg.arrivals, "duration", cfg.duration.String())
+		runOpenLoop(ctx, reqCtx, cfg)
+	} else {
+		slog.Info("starting workers", "workers", cfg.workers, "concurrency", cfg.concurrency, "rounds", cfg.rounds, "duration", cfg.duration.String())
+		runRounds(ctx, reqCtx, cfg)
+	}
+	if err := context.Cause(ctx); errors.Is(err, errTooManyErrors) {
+		slog.Error("aborted the run", "error", err)
+		exitCode = 1
+	}
+	res := collectResults(start, time.Since(start))
+	res.log()
+	if cfg.resultsFile != "" {
+		if err := res.writeFile(cfg.resultsFile); err != nil {
+			slog.Error("failed to write the results", "error", err)
+		} else {
+			slog.Info("wrote the results", "file", cfg.resultsFile)
+		}
+	}
+	if cfg.histogramFile != "" {
+		if err := latencies.writeFile(cfg.histogramFile); err != nil {
+			slog.Error("failed to write the latency histogram", "error", err)
+		} else {
+			slog.Info("wrote the latency histogram", "file", cfg.histogramFile)
+		}
+	}
+}
+
+// runRounds sends a round of cfg.workers requests every cfg.interval, until
+// cfg.rounds rounds have run or ctx is done. The requests are sent with reqCtx
+// by a pool of cfg.concurrency workers.
+func runRounds(ctx, reqCtx context.Context, cfg config) {
+	p := newWorkerPool(reqCtx, cfg)
+	defer p.close()
+	t := time.NewTicker(cfg.interval)
+	defer t.Stop()
+	for i := 0; cfg.rounds == 0 || i < cfg.rounds; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		slog.Info("simulating client requests", "round", i)
+		rctx := ctx
+		var span trace.Span
+		if cfg.roundSpans {
+			rctx, span = startRoundSpan(ctx, i)
 		}
-		i++
+		err := p.run(rctx, cfg.workers)
+		if span != nil {
+			endSpan(span, err)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("aborted round", "round", i, "error", err)
+		}
+		slog.Info("simulated requests", "round", i, "requests", cfg.workers, latencies.takeRound().attr())
 	}
 }
 
-// run is the worker generator in concurrent.
-func run(workers, concurrency int) error {
-	respErrCh := make(chan error)
-	concCh := make(chan bool, concurrency)
-	for n := 0; n < workers; n++ {
-		go func() {
-			concCh <- true
-			defer func() {
-				<-concCh
-			}()
-			respErrCh <- func() error {
-				q := testCases[rand.Intn(len(testCases))]
-				matched, err := runQuery(q.query)
-				if err != nil {
-					return err
-				}
-				check(q, matched)
-				return nil
-			}()
-		}()
-	}
-
-	for i := 0; i < workers; i++ {
-		if err := <-respErrCh; err != nil {
+// fatal logs msg with the key-value pairs in args as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// runOnce sends a query of the scenario at random to the client, or all of
+// its queries in batch mode, checks their counts, and records the outcome in
+// totals.
+func runOnce(ctx context.Context, cfg config) error {
+	totals.requests.Add(1)
+	start := time.Now()
+	err := func() error {
+		if cfg.batch {
+			var counts []int
+			var err error
+			if serverClient != nil {
+				counts, err = runBatchRPC(ctx, cfg.scenario.queries)
+			} else {
+				counts, err = runBatch(ctx, cfg.targets.pick(), cfg.scenario.queries)
+			}
+			if err != nil {
+				return err
+			}
+			for i, q := range cfg.scenario.queries {
+				check(q, counts[i])
+			}
+			return nil
+		}
+		q := cfg.scenario.pick()
+		var matched int
+		var err error
+		if serverClient != nil {
+			matched, err = runRPC(ctx, q.query)
+		} else {
+			matched, err = runQuery(ctx, cfg.targets.pick(), q.query)
+		}
+		if err != nil {
 			return err
 		}
+		check(q, matched)
+		return nil
+	}()
+	// the latency of the failed requests is recorded too, since the timeouts
+	// make the tail of the latency. The canceled requests are left out.
+	switch {
+	case err == nil:
+		latencies.record(time.Since(start))
+		totals.succeeded.Add(1)
+	case ctx.Err() != nil:
+		totals.canceled.Add(1)
+	default:
+		latencies.record(time.Since(start))
+		totals.failed.Add(1)
 	}
-	return nil
+	return err
 }
 
-// runQuery throws a query s to the client and returns the number of matched line results
+// runQuery throws a query s to the client at reqURL and returns the number of matched line results
 //
 // TODO: instrument this method to trace all requests down to the server.
-func runQuery(s string) (int, error) {
+func runQuery(ctx context.Context, reqURL url.URL, s string) (matched int, err error) {
 	v := url.Values{}
 	v.Set("q", s)
 	reqURL.RawQuery = v.Encode()
 
 	// step1. instrument trace
-	ctx := context.Background()
 	tr := otel.Tracer("loadgen")
 	ctx, span := tr.Start(ctx, "query.request", trace.WithAttributes(
 		semconv.TelemetrySDKLanguageGo,
 		semconv.ServiceNameKey.String("loadgen.runQuery"),
 		attribute.Key("query").String(s),
+		attribute.Key("loadgen.target").String(reqURL.Host),
 	))
-	defer span.End()
+	defer func() { endSpan(span, err) }()
 	ctx = httptrace.WithClientTrace(ctx, otelhttptrace.NewClientTrace(ctx))
-	req, err := http.NewRequestWithContext(ctx, "GET", reqURL.String(), nil)
-	if err != nil {
-		return -1, fmt.Errorf("error creating HTTP request object: %v", err)
-	}
-	resp, err := httpClient.Do(req)
+	data, err := get(ctx, reqURL.String())
 	// step1. end instrumentation
 	if err != nil {
-		return -1, fmt.Errorf("error sending request to %v: %v", reqURL.String(), err)
-	}
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return -1, fmt.Errorf("error reading response body: %v", err)
+		return -1, err
 	}
 	r := struct {
 		Matched int `json:"match_count"`
@@ -179,11 +384,72 @@ func runQuery(s string) (int, error) {
 	return r.Matched, nil
 }
 
+// runBatch throws all the queries qs to the batch endpoint of the client at u
+// in a single request and returns the number of matched lines of each of them.
+func runBatch(ctx context.Context, u url.URL, qs []query) (counts []int, err error) {
+	v := url.Values{}
+	for _, q := range qs {
+		v.Add("q", q.query)
+	}
+	u.Path = "/batch"
+	u.RawQuery = v.Encode()
+
+	tr := otel.Tracer("loadgen")
+	ctx, span := tr.Start(ctx, "query.batch", trace.WithAttributes(
+		attribute.Key("queries").Int(len(qs)),
+		attribute.Key("loadgen.target").String(u.Host),
+	))
+	defer func() { endSpan(span, err) }()
+	ctx = httptrace.WithClientTrace(ctx, otelhttptrace.NewClientTrace(ctx))
+	data, err := get(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	r := struct {
+		Matched []int `json:"match_counts"`
+	}{}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Matched) != len(qs) {
+		return nil, fmt.Errorf("got %d counts for %d queries: %s", len(r.Matched), len(qs), data)
+	}
+	return r.Matched, nil
+}
+
+// get sends a GET request to u and returns the body of the response. The
+// requests that fail with a transient error are retried with retry.
+func get(ctx context.Context, u string) ([]byte, error) {
+	var data []byte
+	err := retry.do(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return fmt.Errorf("error creating HTTP request object: %v", err)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("error sending request to %v: %w", u, err)
+		}
+		defer resp.Body.Close()
+		data, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading response body: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return &httpError{url: u, status: resp.Status, code: resp.StatusCode, body: data}
+		}
+		return nil
+	})
+	return data, err
+}
+
 // check compares expected counts of the query word and matched count
 func check(q query, matched int) {
-	if q.wantCount != matched {
-		log.Printf("query '%s' had issue: expected %d, matched %d", q.query, q.wantCount, matched)
+	ok := q.expected(matched)
+	totals.recordQuery(q.query, ok)
+	if !ok {
+		slog.Warn("unexpected match count", "query", q.query, "want", q.want(), "matched", matched)
 		return
 	}
-	log.Printf("query '%s': matched %d", q.query, matched)
+	slog.Info("matched query", "query", q.query, "matched", matched)
 }
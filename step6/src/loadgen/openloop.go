@@ -0,0 +1,174 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxOpenLoopInFlight bounds the number of requests of the open loop that
+	// wait for their response, so that the loadgen doesn't run out of memory
+	// when the client stops answering. The requests over it are dropped.
+	maxOpenLoopInFlight = 1000
+
+	// openLoopTick is the interval at which the open loop sends the requests
+	// that are due.
+	openLoopTick = 10 * time.Millisecond
+)
+
+// openLoopStats counts the requests of the open loop since the last report.
+type openLoopStats struct {
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+	// lastError is the error of the last failed request.
+	lastError atomic.Pointer[error]
+}
+
+// runOpenLoop sends requests to the client at the rate of cfg.load until ctx
+// is done, and then waits for the requests in flight, which are sent with
+// reqCtx. Unlike the rounds of workers, which wait for their
+// responses before the next round, the requests are sent on a fixed schedule
+// whatever their latency, so that the requests queue up in the server once it
+// is saturated, as they would with real users. The number of requests sent is
+// logged every cfg.interval.
+func runOpenLoop(ctx, reqCtx context.Context, cfg config) {
+	var stats openLoopStats
+	var wg sync.WaitGroup
+	inFlight := make(chan struct{}, maxOpenLoopInFlight)
+	report := time.NewTicker(cfg.interval)
+	defer report.Stop()
+	tick := time.NewTicker(openLoopTick)
+	defer tick.Stop()
+	arrive := constantArrivals()
+	if cfg.arrivals == "poisson" {
+		arrive = poissonArrivals
+	}
+	// with cfg.roundSpans, the requests of every interval are the children
+	// of the span of a round.
+	var span trace.Span
+	round := 0
+	if cfg.roundSpans {
+		_, span = startRoundSpan(ctx, round)
+	}
+	start := time.Now()
+	last := start
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			if span != nil {
+				span.End()
+			}
+			return
+		case now := <-report.C:
+			logOpenLoop(&stats, cfg.load(now.Sub(start)), cfg.interval)
+			if span != nil {
+				span.End()
+				round++
+				_, span = startRoundSpan(ctx, round)
+			}
+		case now := <-tick.C:
+			// the arrivals are counted from the time of the ticks, so that
+			// the rate doesn't drift when the ticks are late.
+			n := arrive(cfg.load(now.Sub(start)), now.Sub(last).Seconds())
+			last = now
+			rctx := reqCtx
+			if span != nil {
+				rctx = trace.ContextWithSpan(reqCtx, span)
+			}
+			for ; n > 0; n-- {
+				select {
+				case inFlight <- struct{}{}:
+					stats.sent.Add(1)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						defer func() { <-inFlight }()
+						if err := runOnce(rctx, cfg); err != nil && reqCtx.Err() == nil {
+							stats.failed.Add(1)
+							stats.lastError.Store(&err)
+						}
+					}()
+				default:
+					stats.dropped.Add(1)
+				}
+			}
+		}
+	}
+}
+
+// arrivals returns the number of requests that arrive in dt seconds at the
+// rate of rate requests per second.
+type arrivals func(rate, dt float64) int
+
+// constantArrivals returns arrivals at regular intervals: the requests arrive
+// every 1/rate seconds.
+func constantArrivals() arrivals {
+	// due is the part of a request accrued since the last arrival.
+	var due float64
+	return func(rate, dt float64) int {
+		due += rate * dt
+		n := math.Floor(due)
+		due -= n
+		return int(n)
+	}
+}
+
+// poissonArrivals returns the arrivals of a Poisson process of rate λ=rate: the
+// times between the requests are random and exponentially distributed, with a
+// mean of 1/rate seconds, like the requests of independent users. The
+// requests come in bursts and lulls, which make the queues of the server
+// grow and the tail of the latency longer than with constant arrivals.
+func poissonArrivals(rate, dt float64) int {
+	n := 0
+	// the process is memoryless, so that the time to the next arrival can be
+	// drawn anew on every tick.
+	for t := rand.ExpFloat64() / rate; t < dt; t += rand.ExpFloat64() / rate {
+		n++
+	}
+	return n
+}
+
+// logOpenLoop logs the counts of stats and the latency of the requests over
+// the last interval, and the target rate of the requests, and resets them.
+func logOpenLoop(stats *openLoopStats, target float64, interval time.Duration) {
+	sent, failed, dropped := stats.sent.Swap(0), stats.failed.Swap(0), stats.dropped.Swap(0)
+	args := []any{
+		"target_qps", target,
+		"qps", float64(sent) / interval.Seconds(),
+		"requests", sent,
+		"failed", failed,
+		"dropped", dropped,
+		latencies.takeRound().attr(),
+	}
+	level := slog.LevelInfo
+	if err := stats.lastError.Swap(nil); err != nil && failed > 0 {
+		args = append(args, "last_error", *err)
+	}
+	if failed > 0 || dropped > 0 {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "simulated requests", args...)
+}
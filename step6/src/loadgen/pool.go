@@ -0,0 +1,98 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// workerPool sends the requests of the rounds from a fixed number of
+// goroutines, which take them from a channel, so that the number of
+// goroutines of the loadgen stays the same whatever the number of requests
+// of a round and however long they take.
+type workerPool struct {
+	jobs chan *round
+	wg   sync.WaitGroup
+}
+
+// newWorkerPool starts cfg.concurrency workers, which send their requests
+// with ctx until the pool is closed.
+func newWorkerPool(ctx context.Context, cfg config) *workerPool {
+	p := &workerPool{jobs: make(chan *round)}
+	p.wg.Add(cfg.concurrency)
+	for i := 0; i < cfg.concurrency; i++ {
+		go func() {
+			defer p.wg.Done()
+			for r := range p.jobs {
+				r.done(runOnce(trace.ContextWithSpan(ctx, r.span), cfg))
+			}
+		}()
+	}
+	return p
+}
+
+// run sends n requests with the workers of p, and waits for them. It returns
+// the first of their errors, like errgroup.Group.Wait. No request is sent
+// once ctx is done, and the error of ctx counts as the error of the requests
+// that weren't sent. The spans of the requests are the children of the span
+// in ctx, if any.
+func (p *workerPool) run(ctx context.Context, n int) error {
+	r := &round{span: trace.SpanFromContext(ctx)}
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			r.fail(ctx.Err())
+			break
+		}
+		r.wg.Add(1)
+		select {
+		case p.jobs <- r:
+		case <-ctx.Done():
+			r.done(ctx.Err())
+		}
+	}
+	r.wg.Wait()
+	return r.err
+}
+
+// close stops the workers of p once their requests are done, and waits for
+// them.
+func (p *workerPool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// round is the requests of a round, the parent of their spans, and the first
+// of their errors.
+type round struct {
+	span trace.Span
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+// done records the end of a request of r that returned err.
+func (r *round) done(err error) {
+	if err != nil {
+		r.fail(err)
+	}
+	r.wg.Done()
+}
+
+func (r *round) fail(err error) {
+	r.once.Do(func() { r.err = err })
+}
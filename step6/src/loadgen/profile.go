@@ -0,0 +1,105 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadProfile returns the rate of the requests of the open loop, in requests
+// per second, elapsed after its start.
+type loadProfile func(elapsed time.Duration) float64
+
+// constantLoad returns the profile of a constant rate of qps requests per
+// second.
+func constantLoad(qps float64) loadProfile {
+	return func(time.Duration) float64 { return qps }
+}
+
+// rampLoad returns the profile of a rate that increases linearly from from
+// to to requests per second over d, and stays at to after that.
+func rampLoad(from, to float64, d time.Duration) loadProfile {
+	return func(elapsed time.Duration) float64 {
+		if elapsed >= d {
+			return to
+		}
+		return from + (to-from)*float64(elapsed)/float64(d)
+	}
+}
+
+// stepLoad returns the profile of a rate that stays at every one of levels,
+// in requests per second, for d, and at the last level after that.
+func stepLoad(levels []float64, d time.Duration) loadProfile {
+	return func(elapsed time.Duration) float64 {
+		i := int(elapsed / d)
+		if i >= len(levels) {
+			i = len(levels) - 1
+		}
+		return levels[i]
+	}
+}
+
+// parseLoadProfile parses the load profiles of the -profile flag:
+//
+//   - "ramp:10-200/5m" increases the rate from 10 to 200 requests per second
+//     over 5 minutes.
+//   - "steps:10,50,100,200/1m" sends 10 requests per second for a minute,
+//     then 50 for a minute, and so on.
+//
+// The rate then stays at its last value until the loadgen is stopped.
+func parseLoadProfile(v string) (loadProfile, error) {
+	kind, spec, _ := strings.Cut(v, ":")
+	rates, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid load profile %q: missing the duration after /", v)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid load profile %q: the duration must be positive, got %q", v, period)
+	}
+	var sep string
+	switch kind {
+	case "ramp":
+		sep = "-"
+	case "steps":
+		sep = ","
+	default:
+		return nil, fmt.Errorf("invalid load profile %q: unknown profile %q, want ramp or steps", v, kind)
+	}
+	var levels []float64
+	var peak float64
+	for _, s := range strings.Split(rates, sep) {
+		qps, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || qps < 0 || math.IsInf(qps, 0) || math.IsNaN(qps) {
+			return nil, fmt.Errorf("invalid load profile %q: the rates must be 0 or positive numbers, got %q", v, s)
+		}
+		levels = append(levels, qps)
+		peak = math.Max(peak, qps)
+	}
+	if peak == 0 {
+		return nil, fmt.Errorf("invalid load profile %q: all the rates are 0", v)
+	}
+	if kind == "ramp" {
+		if len(levels) != 2 {
+			return nil, fmt.Errorf("invalid load profile %q: a ramp goes from one rate to another, e.g. ramp:10-200/5m", v)
+		}
+		return rampLoad(levels[0], levels[1], d), nil
+	}
+	return stepLoad(levels, d), nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"opentelemetry-trace-codelab-go/loadgen/shakesapp"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultReadyTimeout = 2 * time.Minute
+
+	// readyInitialBackoff is the pause after the first failed check of the
+	// readiness of the targets, doubled after every check up to
+	// readyMaxBackoff.
+	readyInitialBackoff = 500 * time.Millisecond
+	readyMaxBackoff     = 5 * time.Second
+
+	// readyCheckTimeout bounds every check of the readiness of a target.
+	readyCheckTimeout = 2 * time.Second
+
+	// healthMethodPrefix is the prefix of the methods of the health service
+	// of the server.
+	healthMethodPrefix = "/grpc.health.v1.Health/"
+)
+
+// waitForReady checks the readiness of the targets of cfg until they are all
+// ready, with an exponential backoff, so that the pods that are still starting
+// after a deploy don't fail the first rounds. The targets are the /readyz
+// endpoints of the clients, which are ready once their server is serving, or
+// the health of ShakespeareService on the server when it is called directly.
+// It returns the error of the last check when the targets aren't ready within
+// cfg.readyTimeout or ctx is done.
+//
+// The checks aren't traced, so that a slow start doesn't fill Cloud Trace with
+// the traces of the failed checks.
+func waitForReady(ctx context.Context, cfg config) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.readyTimeout)
+	defer cancel()
+	start := time.Now()
+	backoff := readyInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := checkReady(ctx, cfg)
+		if err == nil {
+			slog.Info("the targets are ready", "attempts", attempt, "waited", time.Since(start).Round(time.Millisecond).String())
+			return nil
+		}
+		slog.Info("waiting for the targets to be ready", "attempt", attempt, "error", err)
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		backoff = min(2*backoff, readyMaxBackoff)
+	}
+}
+
+// checkReady checks the readiness of all the targets of cfg once.
+func checkReady(ctx context.Context, cfg config) error {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	if serverHealth != nil {
+		resp, err := serverHealth.Check(ctx, &healthpb.HealthCheckRequest{
+			Service: shakesapp.ShakespeareService_ServiceDesc.ServiceName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to check the health of the server at %s: %v", cfg.server, err)
+		}
+		if s := resp.GetStatus(); s != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("the server at %s is %v", cfg.server, s)
+		}
+		return nil
+	}
+	for _, target := range cfg.targets.urls {
+		u := *target
+		u.Path = "/readyz"
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return fmt.Errorf("error creating HTTP request object: %v", err)
+		}
+		// http.DefaultClient isn't instrumented, unlike httpClient.
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("error sending request to %v: %v", u.String(), err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("error reading response body: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%v isn't ready: %s: %s", u.String(), resp.Status, bytes.TrimSpace(data))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestLogsPerSecond bounds the number of failed and slow requests
+// logged every second, so that a broken backend doesn't flood the logs.
+const maxRequestLogsPerSecond = 10
+
+// requestLogger logs the trace of the requests of the loadgen that failed, or
+// that took longer than slow, when their spans end, so that their log lines
+// point to their traces. Only the sampled requests are logged, since the
+// others have no trace to look at.
+type requestLogger struct {
+	// slow is the latency over which the requests are logged, or 0 to log
+	// the failed requests only.
+	slow time.Duration
+
+	mu     sync.Mutex
+	second time.Time
+	logged int
+}
+
+func newRequestLogger(slow time.Duration) *requestLogger {
+	return &requestLogger{slow: slow}
+}
+
+func (l *requestLogger) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (l *requestLogger) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.Name() != "query.request" && s.Name() != "query.batch" {
+		return
+	}
+	d := s.EndTime().Sub(s.StartTime())
+	failed := s.Status().Code == codes.Error
+	if !failed && (l.slow == 0 || d <= l.slow) {
+		return
+	}
+	if !l.allow(s.EndTime()) {
+		return
+	}
+	// the logger adds the trace_id and span_id of the span in the context.
+	ctx := trace.ContextWithSpanContext(context.Background(), s.SpanContext())
+	args := []any{
+		"span", s.Name(),
+		"duration_ms", d.Milliseconds(),
+		"trace_url", telemetry.TraceURL(s.SpanContext().TraceID()),
+	}
+	if failed {
+		slog.WarnContext(ctx, "failed request", append(args, "error", s.Status().Description)...)
+		return
+	}
+	slog.WarnContext(ctx, "slow request", append(args, "threshold_ms", l.slow.Milliseconds())...)
+}
+
+// allow returns whether a request that ended at t can be logged within the
+// limit of maxRequestLogsPerSecond.
+func (l *requestLogger) allow(t time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if sec := t.Truncate(time.Second); !sec.Equal(l.second) {
+		l.second, l.logged = sec, 0
+	}
+	l.logged++
+	return l.logged <= maxRequestLogsPerSecond
+}
+
+func (l *requestLogger) Shutdown(context.Context) error   { return nil }
+func (l *requestLogger) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,108 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+)
+
+// retry is the retry policy of the requests, set in main.
+var retry = retryPolicy{maxAttempts: 1}
+
+// retryPolicy retries the requests that fail with a transient error, such as a
+// refused connection while the client pod restarts or a 5xx response, with an
+// exponential backoff. The pauses are jittered so that the workers don't all
+// retry at the same time.
+type retryPolicy struct {
+	// maxAttempts is the number of attempts of a request, 1 for no retries.
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// do calls f until it succeeds, fails with an error that isn't transient, or
+// has been called p.maxAttempts times, and returns its last error. The number
+// of calls is set as the attempts attribute of the span of ctx, and every retry
+// is recorded as an event of the span and counted in totals.
+func (p retryPolicy) do(ctx context.Context, f func() error) error {
+	span := trace.SpanFromContext(ctx)
+	backoff := p.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.maxAttempts || !isTransient(err) {
+			span.SetAttributes(attribute.Key("attempts").Int(attempt))
+			return err
+		}
+		// full jitter: pause for a random time up to the backoff.
+		pause := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Key("attempt").Int(attempt+1),
+			attribute.Key("error").String(err.Error()),
+			attribute.Key("backoff_ms").Int64(pause.Milliseconds()),
+		))
+		totals.retries.Add(1)
+		t := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			span.SetAttributes(attribute.Key("attempts").Int(attempt))
+			return err
+		case <-t.C:
+		}
+		backoff = min(2*backoff, p.maxBackoff)
+	}
+}
+
+// httpError is the error of a response of the client whose status isn't 200 OK.
+type httpError struct {
+	url    string
+	status string
+	code   int
+	body   []byte
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("error response from %v: %s: %s", e.url, e.status, e.body)
+}
+
+// isTransient returns whether err is a refused connection, a 5xx response of
+// the client, or an UNAVAILABLE error of the server, which may not happen again
+// on the next attempt.
+func isTransient(err error) bool {
+	var he *httpError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return true
+	case errors.As(err, &he):
+		return he.code >= 500
+	default:
+		return status.Code(err) == codes.Unavailable
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxWeight bounds the weight of a query of a scenario file.
+const maxWeight = 1000
+
+// scenario is the test cases of the loadgen: the queries that it sends and
+// their expected counts.
+type scenario struct {
+	// queries are all sent in a single request in batch mode.
+	queries []query
+	// picks holds the index of every query in queries as many times as its
+	// weight, so that the workers pick the queries at random in proportion
+	// to their weights.
+	picks []int
+}
+
+// newScenario returns the scenario of the queries qs, which all have the same
+// weight.
+func newScenario(qs []query) scenario {
+	s := scenario{queries: qs}
+	for i := range qs {
+		s.picks = append(s.picks, i)
+	}
+	return s
+}
+
+// pick returns a query of s at random.
+func (s scenario) pick() query {
+	return s.queries[s.picks[rand.Intn(len(s.picks))]]
+}
+
+// scenarioFile is the content of a scenario file, in YAML or JSON:
+//
+//	queries:
+//	  - query: love
+//	    count: 3040
+//	    weight: 5
+//	    tolerance: 5%
+//	  - query: to be, or not to be
+//	    count: 1
+//	  - query: sweet
+//	    match: ^[0-9]{3}$
+//
+// count is the expected number of matched lines of the query, and weight its
+// relative frequency in the requests, 1 by default. tolerance accepts the
+// counts within a number of lines, or a percentage ending with %, of count,
+// see parseTolerance. match is a regular expression matched against the counts
+// in decimal, instead of count.
+type scenarioFile struct {
+	Queries []scenarioQuery `yaml:"queries"`
+}
+
+type scenarioQuery struct {
+	Query     string  `yaml:"query"`
+	Count     *int    `yaml:"count"`
+	Tolerance *string `yaml:"tolerance"`
+	Match     *string `yaml:"match"`
+	Weight    *int    `yaml:"weight"`
+}
+
+// loadScenario reads the scenario file at path. The counts of the queries
+// without a tolerance of their own are accepted within t.
+func loadScenario(path string, t tolerance) (scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario{}, fmt.Errorf("failed to read scenario file: %v", err)
+	}
+	s, err := parseScenario(data, t)
+	if err != nil {
+		return scenario{}, fmt.Errorf("invalid scenario file %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// parseScenario parses data in the format of scenarioFile. JSON is parsed as
+// YAML, which is a superset of it. The counts of the queries without a
+// tolerance of their own are accepted within t.
+func parseScenario(data []byte, t tolerance) (scenario, error) {
+	var f scenarioFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	// reject the misspelled fields instead of ignoring them.
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return scenario{}, err
+	}
+	if len(f.Queries) == 0 {
+		return scenario{}, errors.New("no queries")
+	}
+	var s scenario
+	for i, q := range f.Queries {
+		if q.Query == "" {
+			return scenario{}, fmt.Errorf("query %d: the query is empty", i)
+		}
+		qq := query{query: q.Query, tolerance: t}
+		switch {
+		case q.Match != nil:
+			if q.Count != nil || q.Tolerance != nil {
+				return scenario{}, fmt.Errorf("query %d (%q): match can't be set with count or tolerance", i, q.Query)
+			}
+			re, err := regexp.Compile(*q.Match)
+			if err != nil {
+				return scenario{}, fmt.Errorf("query %d (%q): invalid match: %v", i, q.Query, err)
+			}
+			qq.pattern = re
+		case q.Count == nil || *q.Count < 0:
+			return scenario{}, fmt.Errorf("query %d (%q): count must be set to the expected number of matched lines, or match to a regular expression of the count", i, q.Query)
+		default:
+			qq.wantCount = *q.Count
+			if q.Tolerance != nil {
+				tol, err := parseTolerance(*q.Tolerance)
+				if err != nil {
+					return scenario{}, fmt.Errorf("query %d (%q): %v", i, q.Query, err)
+				}
+				qq.tolerance = tol
+			}
+		}
+		weight := 1
+		if q.Weight != nil {
+			weight = *q.Weight
+		}
+		if weight < 1 || weight > maxWeight {
+			return scenario{}, fmt.Errorf("query %d (%q): weight must be between 1 and %d, got %d", i, q.Query, maxWeight, weight)
+		}
+		s.queries = append(s.queries, qq)
+		for n := 0; n < weight; n++ {
+			s.picks = append(s.picks, i)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,215 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.19.4
+// source: shakesapp.proto
+
+package shakesapp
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ShakespeareServiceClient is the client API for ShakespeareService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ShakespeareServiceClient interface {
+	// Accepts a query string and returns the number of lines containing that.
+	GetMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (*ShakespeareResponse, error)
+	// Accepts several query strings and returns the number of lines containing
+	// each of them, counted in a single pass over the corpus.
+	GetMatchCounts(ctx context.Context, in *BatchShakespeareRequest, opts ...grpc.CallOption) (*BatchShakespeareResponse, error)
+	// Accepts a query string and streams the number of lines containing that
+	// as the texts are read, once per text.
+	StreamMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (ShakespeareService_StreamMatchCountClient, error)
+}
+
+type shakespeareServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShakespeareServiceClient(cc grpc.ClientConnInterface) ShakespeareServiceClient {
+	return &shakespeareServiceClient{cc}
+}
+
+func (c *shakespeareServiceClient) GetMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (*ShakespeareResponse, error) {
+	out := new(ShakespeareResponse)
+	err := c.cc.Invoke(ctx, "/shakesapp.ShakespeareService/GetMatchCount", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shakespeareServiceClient) GetMatchCounts(ctx context.Context, in *BatchShakespeareRequest, opts ...grpc.CallOption) (*BatchShakespeareResponse, error) {
+	out := new(BatchShakespeareResponse)
+	err := c.cc.Invoke(ctx, "/shakesapp.ShakespeareService/GetMatchCounts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shakespeareServiceClient) StreamMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (ShakespeareService_StreamMatchCountClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ShakespeareService_ServiceDesc.Streams[0], "/shakesapp.ShakespeareService/StreamMatchCount", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shakespeareServiceStreamMatchCountClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ShakespeareService_StreamMatchCountClient interface {
+	Recv() (*PartialMatchCount, error)
+	grpc.ClientStream
+}
+
+type shakespeareServiceStreamMatchCountClient struct {
+	grpc.ClientStream
+}
+
+func (x *shakespeareServiceStreamMatchCountClient) Recv() (*PartialMatchCount, error) {
+	m := new(PartialMatchCount)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ShakespeareServiceServer is the server API for ShakespeareService service.
+// All implementations must embed UnimplementedShakespeareServiceServer
+// for forward compatibility
+type ShakespeareServiceServer interface {
+	// Accepts a query string and returns the number of lines containing that.
+	GetMatchCount(context.Context, *ShakespeareRequest) (*ShakespeareResponse, error)
+	// Accepts several query strings and returns the number of lines containing
+	// each of them, counted in a single pass over the corpus.
+	GetMatchCounts(context.Context, *BatchShakespeareRequest) (*BatchShakespeareResponse, error)
+	// Accepts a query string and streams the number of lines containing that
+	// as the texts are read, once per text.
+	StreamMatchCount(*ShakespeareRequest, ShakespeareService_StreamMatchCountServer) error
+	mustEmbedUnimplementedShakespeareServiceServer()
+}
+
+// UnimplementedShakespeareServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedShakespeareServiceServer struct {
+}
+
+func (UnimplementedShakespeareServiceServer) GetMatchCount(context.Context, *ShakespeareRequest) (*ShakespeareResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMatchCount not implemented")
+}
+func (UnimplementedShakespeareServiceServer) GetMatchCounts(context.Context, *BatchShakespeareRequest) (*BatchShakespeareResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMatchCounts not implemented")
+}
+func (UnimplementedShakespeareServiceServer) StreamMatchCount(*ShakespeareRequest, ShakespeareService_StreamMatchCountServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMatchCount not implemented")
+}
+func (UnimplementedShakespeareServiceServer) mustEmbedUnimplementedShakespeareServiceServer() {}
+
+// UnsafeShakespeareServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShakespeareServiceServer will
+// result in compilation errors.
+type UnsafeShakespeareServiceServer interface {
+	mustEmbedUnimplementedShakespeareServiceServer()
+}
+
+func RegisterShakespeareServiceServer(s grpc.ServiceRegistrar, srv ShakespeareServiceServer) {
+	s.RegisterService(&ShakespeareService_ServiceDesc, srv)
+}
+
+func _ShakespeareService_GetMatchCount_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShakespeareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShakespeareServiceServer).GetMatchCount(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shakesapp.ShakespeareService/GetMatchCount",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShakespeareServiceServer).GetMatchCount(ctx, req.(*ShakespeareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShakespeareService_GetMatchCounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchShakespeareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShakespeareServiceServer).GetMatchCounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shakesapp.ShakespeareService/GetMatchCounts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShakespeareServiceServer).GetMatchCounts(ctx, req.(*BatchShakespeareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShakespeareService_StreamMatchCount_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ShakespeareRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShakespeareServiceServer).StreamMatchCount(m, &shakespeareServiceStreamMatchCountServer{stream})
+}
+
+type ShakespeareService_StreamMatchCountServer interface {
+	Send(*PartialMatchCount) error
+	grpc.ServerStream
+}
+
+type shakespeareServiceStreamMatchCountServer struct {
+	grpc.ServerStream
+}
+
+func (x *shakespeareServiceStreamMatchCountServer) Send(m *PartialMatchCount) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ShakespeareService_ServiceDesc is the grpc.ServiceDesc for ShakespeareService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ShakespeareService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shakesapp.ShakespeareService",
+	HandlerType: (*ShakespeareServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetMatchCount",
+			Handler:    _ShakespeareService_GetMatchCount_Handler,
+		},
+		{
+			MethodName: "GetMatchCounts",
+			Handler:    _ShakespeareService_GetMatchCounts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMatchCount",
+			Handler:       _ShakespeareService_StreamMatchCount_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "shakesapp.proto",
+}
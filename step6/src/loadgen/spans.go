@@ -0,0 +1,69 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startRunSpan starts the loadgen.run span of the run of cfg, which the spans
+// of its rounds link to.
+func startRunSpan(ctx context.Context, cfg config) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.Key("loadgen.batch").Bool(cfg.batch),
+	}
+	if cfg.load != nil {
+		attrs = append(attrs,
+			attribute.Key("loadgen.target_qps").Float64(cfg.load(0)),
+			attribute.Key("loadgen.arrivals").String(cfg.arrivals),
+		)
+	} else {
+		attrs = append(attrs,
+			attribute.Key("loadgen.workers").Int(cfg.workers),
+			attribute.Key("loadgen.concurrency").Int(cfg.concurrency),
+			attribute.Key("loadgen.rounds").Int(cfg.rounds),
+		)
+	}
+	return otel.Tracer("loadgen").Start(ctx, "loadgen.run", trace.WithAttributes(attrs...))
+}
+
+// startRoundSpan starts the loadgen.round span of the round n, which the
+// query.request spans of the round are the children of. Every round is a
+// trace of its own, so that the traces stay small however long the run, and
+// its span links to the loadgen.run span in ctx, if any.
+func startRoundSpan(ctx context.Context, n int) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.Key("loadgen.round").Int(n)),
+	}
+	if run := trace.SpanContextFromContext(ctx); run.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: run}))
+	}
+	return otel.Tracer("loadgen").Start(ctx, "loadgen.round", opts...)
+}
+
+// endSpan ends span, with the error status of err when it isn't nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// totals counts the requests of the whole run of the loadgen.
+var totals runStats
+
+// runStats counts the requests sent to the client, and their outcomes.
+type runStats struct {
+	requests atomic.Int64
+	// succeeded and failed are the numbers of requests that completed, and
+	// canceled the number of requests that were still in flight when the
+	// run ended.
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	canceled  atomic.Int64
+	// retries is the number of retries of the requests that failed with a
+	// transient error.
+	retries atomic.Int64
+
+	mu sync.Mutex
+	// queries holds the counts of every query of the scenario.
+	queries map[string]*queryStats
+}
+
+// reset sets the counts of s to zero.
+func (s *runStats) reset() {
+	s.requests.Store(0)
+	s.succeeded.Store(0)
+	s.failed.Store(0)
+	s.canceled.Store(0)
+	s.retries.Store(0)
+	s.mu.Lock()
+	s.queries = nil
+	s.mu.Unlock()
+}
+
+// queryStats is the number of times that a query was answered, and the number
+// of these answers whose count isn't the expected one.
+type queryStats struct {
+	answered   int64
+	unexpected int64
+}
+
+// recordQuery records that the query q was answered with the expected count
+// or not.
+func (s *runStats) recordQuery(q string, expected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queries == nil {
+		s.queries = map[string]*queryStats{}
+	}
+	qs := s.queries[q]
+	if qs == nil {
+		qs = &queryStats{}
+		s.queries[q] = qs
+	}
+	qs.answered++
+	if !expected {
+		qs.unexpected++
+	}
+}
+
+// results is the summary of a run of the loadgen, which is logged at the end
+// of the run and written to the results file.
+type results struct {
+	Start            time.Time      `json:"start"`
+	DurationMs       int64          `json:"duration_ms"`
+	Requests         int64          `json:"requests"`
+	QPS              float64        `json:"qps"`
+	Failed           int64          `json:"failed"`
+	Canceled         int64          `json:"canceled"`
+	Retries          int64          `json:"retries"`
+	UnexpectedCounts int64          `json:"unexpected_counts"`
+	LatencyMs        latencyResults `json:"latency_ms"`
+	Queries          []queryResults `json:"queries"`
+}
+
+// latencyResults is the distribution of the latency of the requests of a run,
+// in milliseconds.
+type latencyResults struct {
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+}
+
+// queryResults are the counts of a query of the scenario.
+type queryResults struct {
+	Query            string `json:"query"`
+	Answered         int64  `json:"answered"`
+	UnexpectedCounts int64  `json:"unexpected_counts"`
+}
+
+// collectResults returns the results of the run that started at start and
+// lasted d, from totals and latencies.
+func collectResults(start time.Time, d time.Duration) results {
+	requests := totals.requests.Load()
+	l := latencies.total()
+	r := results{
+		Start:      start,
+		DurationMs: d.Milliseconds(),
+		Requests:   requests,
+		QPS:        float64(requests) / d.Seconds(),
+		Failed:     totals.failed.Load(),
+		Canceled:   totals.canceled.Load(),
+		Retries:    totals.retries.Load(),
+		LatencyMs: latencyResults{
+			P50:  milliseconds(l.p50),
+			P90:  milliseconds(l.p90),
+			P95:  milliseconds(l.p95),
+			P99:  milliseconds(l.p99),
+			Mean: milliseconds(l.mean),
+			Max:  milliseconds(l.maximum),
+		},
+		Queries: []queryResults{},
+	}
+	totals.mu.Lock()
+	for q, qs := range totals.queries {
+		r.Queries = append(r.Queries, queryResults{Query: q, Answered: qs.answered, UnexpectedCounts: qs.unexpected})
+		r.UnexpectedCounts += qs.unexpected
+	}
+	totals.mu.Unlock()
+	// the queries are sorted, so that the files of two runs can be diffed.
+	slices.SortFunc(r.Queries, func(a, b queryResults) int {
+		return strings.Compare(a.Query, b.Query)
+	})
+	return r
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// log logs the summary of r.
+func (r results) log() {
+	slog.Info("finished",
+		"duration_ms", r.DurationMs,
+		"requests", r.Requests,
+		"qps", r.QPS,
+		"failed", r.Failed,
+		"canceled", r.Canceled,
+		"retries", r.Retries,
+		"unexpected_counts", r.UnexpectedCounts,
+		slog.Group("latency_ms",
+			"p50", r.LatencyMs.P50,
+			"p90", r.LatencyMs.P90,
+			"p95", r.LatencyMs.P95,
+			"p99", r.LatencyMs.P99,
+			"mean", r.LatencyMs.Mean,
+			"max", r.LatencyMs.Max,
+		),
+	)
+}
+
+// writeFile writes r to the file at path, in CSV when its extension is .csv
+// and in JSON otherwise.
+func (r results) writeFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if filepath.Ext(path) == ".csv" {
+		err = r.writeCSV(f)
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeCSV writes r to f as name,value rows, with the counts of every query
+// in query.<query>.answered and query.<query>.unexpected_counts.
+func (r results) writeCSV(f *os.File) error {
+	i := strconv.FormatInt
+	g := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	rows := [][]string{
+		{"name", "value"},
+		{"start", r.Start.Format(time.RFC3339)},
+		{"duration_ms", i(r.DurationMs, 10)},
+		{"requests", i(r.Requests, 10)},
+		{"qps", g(r.QPS)},
+		{"failed", i(r.Failed, 10)},
+		{"canceled", i(r.Canceled, 10)},
+		{"retries", i(r.Retries, 10)},
+		{"unexpected_counts", i(r.UnexpectedCounts, 10)},
+		{"latency_ms.p50", g(r.LatencyMs.P50)},
+		{"latency_ms.p90", g(r.LatencyMs.P90)},
+		{"latency_ms.p95", g(r.LatencyMs.P95)},
+		{"latency_ms.p99", g(r.LatencyMs.P99)},
+		{"latency_ms.mean", g(r.LatencyMs.Mean)},
+		{"latency_ms.max", g(r.LatencyMs.Max)},
+	}
+	for _, q := range r.Queries {
+		rows = append(rows,
+			[]string{"query." + q.Query + ".answered", i(q.Answered, 10)},
+			[]string{"query." + q.Query + ".unexpected_counts", i(q.UnexpectedCounts, 10)},
+		)
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll(rows)
+	return w.Error()
+}
@@ -0,0 +1,93 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// targets is the clients that the loadgen sends the requests to, e.g. the
+// stable and the canary versions of the client, and the percentage of the
+// requests sent to each of them.
+type targets struct {
+	urls     []*url.URL
+	percents []int
+	// picks holds the index of every target in urls as many times as its
+	// percentage, so that the requests are split at random in proportion to
+	// the percentages.
+	picks []int
+}
+
+// parseTargets parses a comma-separated list of addresses of clients, each
+// followed by the percentage of the requests sent to it, e.g.
+// "clientservice:8080=90,clientservice-canary:8080=10". The percentages must
+// add up to 100. A single address may leave its percentage out.
+func parseTargets(s string) (targets, error) {
+	var t targets
+	entries := strings.Split(s, ",")
+	total := 0
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		addr, p, hasPercent := strings.Cut(e, "=")
+		if addr == "" {
+			return targets{}, fmt.Errorf("invalid target %q: the address is empty", e)
+		}
+		u, err := url.Parse("http://" + addr)
+		if err != nil {
+			return targets{}, fmt.Errorf("failed to build request URL for %v: %v", addr, err)
+		}
+		percent := 100
+		switch {
+		case hasPercent:
+			if percent, err = strconv.Atoi(p); err != nil || percent <= 0 || percent > 100 {
+				return targets{}, fmt.Errorf("invalid target %q: the percentage must be an integer from 1 to 100", e)
+			}
+		case len(entries) > 1:
+			return targets{}, fmt.Errorf("invalid target %q: every target of a split must set its percentage, e.g. %s=50", e, addr)
+		}
+		total += percent
+		t.urls = append(t.urls, u)
+		t.percents = append(t.percents, percent)
+		for n := 0; n < percent; n++ {
+			t.picks = append(t.picks, len(t.urls)-1)
+		}
+	}
+	if total != 100 {
+		return targets{}, errors.New("the percentages of the targets must add up to 100")
+	}
+	return t, nil
+}
+
+// pick returns the URL of a target of t at random.
+func (t targets) pick() url.URL {
+	return *t.urls[t.picks[rand.Intn(len(t.picks))]]
+}
+
+// String returns the targets in the format of parseTargets.
+func (t targets) String() string {
+	if len(t.urls) == 1 {
+		return t.urls[0].Host
+	}
+	entries := make([]string, len(t.urls))
+	for i, u := range t.urls {
+		entries[i] = u.Host + "=" + strconv.Itoa(t.percents[i])
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// transportConfig is the tuning of the connections of the HTTP client of the
+// loadgen. Its defaults are those of http.DefaultTransport, which keeps only 2
+// idle connections per host: at a high concurrency, most requests then open a
+// new connection, whose dial shows in the httptrace spans of the requests.
+type transportConfig struct {
+	// maxIdleConnsPerHost is the number of idle connections to the client
+	// kept for the next requests, and maxConnsPerHost the number of
+	// connections to the client, or 0 for no limit.
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	dialTimeout         time.Duration
+	tlsHandshakeTimeout time.Duration
+	// keepAlive is the interval of the TCP keep-alive probes, or a negative
+	// duration to disable them. idleConnTimeout is the time after which the
+	// idle connections are closed.
+	keepAlive       time.Duration
+	idleConnTimeout time.Duration
+	// disableKeepAlives makes every request open a new connection.
+	disableKeepAlives bool
+}
+
+// defaultTransportConfig returns the settings of http.DefaultTransport.
+func defaultTransportConfig() transportConfig {
+	return transportConfig{
+		maxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		dialTimeout:         30 * time.Second,
+		tlsHandshakeTimeout: 10 * time.Second,
+		keepAlive:           30 * time.Second,
+		idleConnTimeout:     90 * time.Second,
+	}
+}
+
+// newHTTPTransport returns a copy of http.DefaultTransport with the settings
+// of c.
+func newHTTPTransport(c transportConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	d := &net.Dialer{Timeout: c.dialTimeout, KeepAlive: c.keepAlive}
+	t.DialContext = d.DialContext
+	t.MaxIdleConnsPerHost = c.maxIdleConnsPerHost
+	// the idle connections to all the hosts are bounded too.
+	t.MaxIdleConns = max(t.MaxIdleConns, c.maxIdleConnsPerHost)
+	t.MaxConnsPerHost = c.maxConnsPerHost
+	t.TLSHandshakeTimeout = c.tlsHandshakeTimeout
+	t.IdleConnTimeout = c.idleConnTimeout
+	t.DisableKeepAlives = c.disableKeepAlives
+	return t
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// warmingUp is true during the warmup of the run.
+var warmingUp atomic.Bool
+
+// warmUp sends requests to the client like the run, for cfg.warmup or
+// cfg.warmupRounds rounds, whichever comes first, and then discards their
+// counts and latencies, so that the cold start of the client and the server,
+// such as the first reads of the corpus from Cloud Storage, doesn't skew the
+// summary of the run. The open loop warms up at the initial rate of its
+// profile.
+func warmUp(ctx context.Context, cfg config) {
+	warmingUp.Store(true)
+	defer warmingUp.Store(false)
+	if cfg.warmup > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.warmup)
+		defer cancel()
+	}
+	slog.Info("warming up", "duration", cfg.warmup.String(), "rounds", cfg.warmupRounds)
+	start := time.Now()
+	// the requests in flight at the end of the warmup are canceled and
+	// waited for, so that none of them is counted in the run.
+	if cfg.load != nil {
+		cfg.load = constantLoad(cfg.load(0))
+		runOpenLoop(ctx, ctx, cfg)
+	} else {
+		cfg.rounds = cfg.warmupRounds
+		runRounds(ctx, ctx, cfg)
+	}
+	slog.Info("warmed up",
+		"duration_ms", time.Since(start).Milliseconds(),
+		"requests", totals.requests.Load(),
+		"failed", totals.failed.Load(),
+		latencies.total().attr(),
+	)
+	totals.reset()
+	latencies.reset()
+}
+
+// warmupSampler drops the traces of the requests of the warmup, and samples
+// the other traces with Sampler.
+type warmupSampler struct {
+	sdktrace.Sampler
+}
+
+func (s warmupSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if warmingUp.Load() {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.Drop,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+	return s.Sampler.ShouldSample(p)
+}
+
+func (s warmupSampler) Description() string {
+	return "WarmupSampler{" + s.Sampler.Description() + "}"
+}
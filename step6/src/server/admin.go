@@ -0,0 +1,103 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// startAdminServer serves the admin endpoints of s on ADMIN_ADDR, e.g.
+// "localhost:8082". It does nothing when ADMIN_ADDR is not set, and requires
+// ADMIN_TOKEN when it is, because the endpoints can make the server read the
+// whole corpus again:
+//
+//   - POST /admin/cache/flush removes the cached results and patterns.
+//   - POST /admin/corpus/reload reads the corpus again and rebuilds the index
+//     and the cache, so that the changes of the corpus are picked up without
+//     restarting the pods.
+//
+// The requests must carry ADMIN_TOKEN in an "Authorization: Bearer" header.
+func startAdminServer(s *serverService) error {
+	addr := os.Getenv("ADMIN_ADDR")
+	if addr == "" {
+		return nil
+	}
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return fmt.Errorf("ADMIN_TOKEN must be set with ADMIN_ADDR")
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/cache/flush", s.flushCaches)
+	mux.HandleFunc("POST /admin/corpus/reload", s.reloadCorpusHandler)
+	srv := &http.Server{Handler: adminAuth(token, mux), ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("serving admin endpoints", "addr", lis.Addr().String())
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to serve admin endpoints", "error", err)
+		}
+	}()
+	return nil
+}
+
+// adminAuth rejects the requests that don't carry token as a bearer token.
+func adminAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *serverService) flushCaches(w http.ResponseWriter, r *http.Request) {
+	results, patterns := s.results.flush(), s.patterns.flush()
+	slog.InfoContext(r.Context(), "flushed the caches", "results", results, "patterns", patterns)
+	writeJSON(w, map[string]int{"results": results, "patterns": patterns})
+}
+
+func (s *serverService) reloadCorpusHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if err := s.reloadCorpus(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to reload the corpus", "error", err)
+		http.Error(w, fmt.Sprintf("failed to reload the corpus: %v", err), http.StatusInternalServerError)
+		return
+	}
+	d := time.Since(start)
+	slog.InfoContext(r.Context(), "reloaded the corpus", "duration_ms", d.Milliseconds())
+	writeJSON(w, map[string]int64{"duration_ms": d.Milliseconds()})
+}
+
+// writeJSON writes v as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write the response", "error", err)
+	}
+}
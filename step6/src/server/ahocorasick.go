@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+// ahoCorasick is an Aho–Corasick automaton that finds the occurrences of
+// several patterns in a single pass over a text, instead of one pass for each
+// pattern.
+type ahoCorasick struct {
+	// patterns is the number of patterns.
+	patterns int
+	// next is the transition of every state on every byte, with the failure
+	// links already followed, so that matching never backtracks.
+	next [][256]int32
+	// out is the indexes of the patterns that end at every state, including
+	// the patterns that end at the states of its failure links.
+	out [][]int
+}
+
+// newAhoCorasick builds the automaton of patterns.
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{
+		patterns: len(patterns),
+		next:     make([][256]int32, 1),
+		out:      make([][]int, 1),
+	}
+	for i, p := range patterns {
+		var s int32
+		for j := 0; j < len(p); j++ {
+			c := p[j]
+			if ac.next[s][c] == 0 {
+				ac.next = append(ac.next, [256]int32{})
+				ac.out = append(ac.out, nil)
+				ac.next[s][c] = int32(len(ac.next) - 1)
+			}
+			s = ac.next[s][c]
+		}
+		ac.out[s] = append(ac.out[s], i)
+	}
+
+	// complete the transitions breadth first, so that the failure link of
+	// every state is complete before the state itself.
+	fail := make([]int32, len(ac.next))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if s := ac.next[0][c]; s != 0 {
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		ac.out[s] = append(ac.out[s], ac.out[fail[s]]...)
+		for c := 0; c < 256; c++ {
+			if t := ac.next[s][c]; t != 0 {
+				fail[t] = ac.next[fail[s]][c]
+				queue = append(queue, t)
+			} else {
+				ac.next[s][c] = ac.next[fail[s]][c]
+			}
+		}
+	}
+	return ac
+}
+
+// match calls found with the index of every pattern that occurs in text, once
+// for each of its occurrences.
+func (ac *ahoCorasick) match(text string, found func(pattern int)) {
+	// the empty patterns occur in every text.
+	for _, p := range ac.out[0] {
+		found(p)
+	}
+	var s int32
+	for i := 0; i < len(text); i++ {
+		s = ac.next[s][text[i]]
+		for _, p := range ac.out[s] {
+			found(p)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"opentelemetry-trace-codelab-go/server/shakesapp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxBatchQueries bounds the number of queries of a batch.
+	maxBatchQueries = 100
+	// maxBatchBytes bounds the total length of the queries of a batch, which
+	// bounds the size of its automaton.
+	maxBatchBytes = 4096
+)
+
+// GetMatchCounts counts the lines that contain each of the queries of req in
+// a single pass over the corpus, with an Aho–Corasick automaton of the
+// queries. The queries are matched literally, so a batch of N queries costs
+// about as much as one GetMatchCount request in LITERAL mode, instead of N.
+func (s *serverService) GetMatchCounts(ctx context.Context, req *shakesapp.BatchShakespeareRequest) (resp *shakesapp.BatchShakespeareResponse, err error) {
+	pprof.Do(ctx, profileLabels(ctx, "GetMatchCounts", shakesapp.MatchMode_LITERAL), func(ctx context.Context) {
+		resp, err = s.getMatchCounts(ctx, req)
+	})
+	return resp, err
+}
+
+func (s *serverService) getMatchCounts(ctx context.Context, req *shakesapp.BatchShakespeareRequest) (resp *shakesapp.BatchShakespeareResponse, err error) {
+	resp = &shakesapp.BatchShakespeareResponse{}
+	start := time.Now()
+	defer func() {
+		s.metrics.recordRequest(ctx, "GetMatchCounts", shakesapp.MatchMode_LITERAL, time.Since(start), err)
+	}()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Key("queries").Int(len(req.Queries)),
+		attribute.Key("case_sensitive").Bool(req.CaseSensitive),
+	)
+
+	if len(req.Queries) == 0 || len(req.Queries) > maxBatchQueries {
+		return resp, status.Errorf(codes.InvalidArgument, "a batch must have between 1 and %d queries, got %d", maxBatchQueries, len(req.Queries))
+	}
+	patterns := make([]string, len(req.Queries))
+	size := 0
+	for i, q := range req.Queries {
+		size += len(q)
+		if !req.CaseSensitive {
+			q = strings.ToLower(q)
+		}
+		patterns[i] = q
+	}
+	if size > maxBatchBytes {
+		return resp, status.Errorf(codes.InvalidArgument, "the queries of a batch must be at most %d bytes, got %d", maxBatchBytes, size)
+	}
+
+	readCorpus := s.corpus.Load()
+	if readCorpus == nil {
+		return resp, status.Error(codes.Unavailable, "corpus is not ready")
+	}
+	counter := newBatchCounter(newAhoCorasick(patterns))
+	if err := s.countBatch(ctx, *readCorpus, req.CaseSensitive, counter); err != nil {
+		return resp, err
+	}
+	resp.MatchCounts = counter.counts()
+	return resp, nil
+}
+
+// countBatch passes every line of the corpus to counter, lowercased unless
+// caseSensitive.
+func (s *serverService) countBatch(ctx context.Context, readCorpus corpusReader, caseSensitive bool, counter *batchCounter) error {
+	if cache := s.cache.Load(); cache != nil {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Key("corpus_cache").Bool(true))
+		lines, lower := cache.lines, !caseSensitive
+		if lower && cache.lower {
+			lines, lower = cache.lowerLines, false
+		}
+		err := runShards(ctx, splitShards(len(lines), s.workers), func(ctx context.Context, sh shard) error {
+			for i, line := range lines[sh.lo:sh.hi] {
+				// stop once the client is gone or the deadline has passed.
+				if i%cancelCheckInterval == 0 {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+				}
+				if lower {
+					line = strings.ToLower(line)
+				}
+				counter.add(line)
+			}
+			return nil
+		})
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
+		return nil
+	}
+	readStart := time.Now()
+	stats, err := readCorpus(ctx, func(line string) {
+		if !caseSensitive {
+			line = strings.ToLower(line)
+		}
+		counter.add(line)
+	}, nil)
+	s.metrics.recordRead(ctx, time.Since(readStart), stats)
+	if err != nil {
+		// stop once the client is gone or the deadline has passed.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return fmt.Errorf("fails to read files: %s", err)
+	}
+	return nil
+}
+
+// batchCounter counts the lines in which each pattern of an automaton occurs.
+// add may be called concurrently.
+type batchCounter struct {
+	ac    *ahoCorasick
+	lines []atomic.Int64
+	seen  sync.Pool
+}
+
+// lineSeen marks the patterns already counted for the current line, with the
+// number of the line, so that it isn't cleared between the lines.
+type lineSeen struct {
+	line  int
+	marks []int
+}
+
+func newBatchCounter(ac *ahoCorasick) *batchCounter {
+	b := &batchCounter{ac: ac, lines: make([]atomic.Int64, ac.patterns)}
+	b.seen.New = func() any {
+		return &lineSeen{marks: make([]int, ac.patterns)}
+	}
+	return b
+}
+
+// add counts line for every pattern that occurs in it.
+func (b *batchCounter) add(line string) {
+	seen := b.seen.Get().(*lineSeen)
+	defer b.seen.Put(seen)
+	seen.line++
+	b.ac.match(line, func(p int) {
+		if seen.marks[p] != seen.line {
+			seen.marks[p] = seen.line
+			b.lines[p].Add(1)
+		}
+	})
+}
+
+// counts returns the number of lines counted for every pattern.
+func (b *batchCounter) counts() []int64 {
+	counts := make([]int64, len(b.lines))
+	for i := range b.lines {
+		counts[i] = b.lines[i].Load()
+	}
+	return counts
+}
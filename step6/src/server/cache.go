@@ -0,0 +1,92 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"opentelemetry-trace-codelab-go/internal/lru"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const defaultResultCacheTTL = 5 * time.Minute
+
+// resultCache is a size-bounded LRU cache of the counts of the queries, keyed
+// by the generation of the corpus and queryKey. The entries expire after a TTL
+// so that the counts also follow the changes of the corpus that aren't
+// reloaded. A nil *resultCache caches nothing.
+type resultCache struct {
+	cache   *lru.Cache[string, int64]
+	lookups metric.Int64Counter
+}
+
+// newResultCache returns a cache of RESULT_CACHE_SIZE entries that expire
+// after RESULT_CACHE_TTL, which defaults to 5m. It returns nil when
+// RESULT_CACHE_SIZE is not set, so that every request reads the corpus as in
+// the other steps of the codelab.
+func newResultCache(lookups metric.Int64Counter) (*resultCache, error) {
+	v := os.Getenv("RESULT_CACHE_SIZE")
+	if v == "" {
+		return nil, nil
+	}
+	size, err := strconv.Atoi(v)
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("RESULT_CACHE_SIZE must be a positive integer, got %q", v)
+	}
+	ttl := defaultResultCacheTTL
+	if v := os.Getenv("RESULT_CACHE_TTL"); v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("RESULT_CACHE_TTL must be a positive duration, got %q", v)
+		}
+	}
+	return &resultCache{
+		cache:   lru.New[string, int64](size, ttl),
+		lookups: lookups,
+	}, nil
+}
+
+// get returns the count cached for key, and records the lookup as a hit or a
+// miss.
+func (c *resultCache) get(ctx context.Context, key string) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	count, ok := c.cache.Get(key)
+	c.lookups.Add(ctx, 1, metric.WithAttributes(attribute.Key("hit").Bool(ok)))
+	return count, ok
+}
+
+// flush removes all the entries and returns their number.
+func (c *resultCache) flush() int {
+	if c == nil {
+		return 0
+	}
+	return c.cache.Flush()
+}
+
+// add caches count for key, and evicts the least recently used entry when the
+// cache is full.
+func (c *resultCache) add(key string, count int64) {
+	if c == nil {
+		return
+	}
+	c.cache.Add(key, count)
+}
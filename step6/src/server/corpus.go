@@ -0,0 +1,265 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	bucketProbeTimeout = 10 * time.Second
+
+	// maxLineLength is the length of the longest line that the readers can
+	// scan.
+	maxLineLength = 1 << 20
+
+	// cancelCheckInterval is the number of lines matched between the checks
+	// of the cancellation of the request.
+	cancelCheckInterval = 4096
+)
+
+// embeddedCorpus is a small excerpt of a few plays that is used when neither
+// the Cloud Storage bucket nor CORPUS_DIR is available.
+//
+//go:embed corpus/*.txt
+var embeddedCorpus embed.FS
+
+// corpusReader calls visit with every line of the texts that GetMatchCount
+// searches, as it reads them, so that the texts are never held in memory as a
+// whole. visit may be called concurrently for the lines of different texts.
+// When done isn't nil, it is called with the name of every text once all of
+// its lines have been visited.
+type corpusReader func(ctx context.Context, visit func(line string), done func(name string)) (corpusStats, error)
+
+// corpusStats is the number of texts and the number of bytes read by a
+// corpusReader.
+type corpusStats struct {
+	objects int
+	bytes   int
+}
+
+// newCorpusReader selects the source of the texts at startup.
+// When CORPUS_DIR is set, the server reads the .txt files in that directory
+// instead of the files in the Cloud Storage bucket, so that the codelab can
+// be completed without access to the bucket. When CORPUS_DIR is not set and
+// the bucket can't be reached either, the server falls back to the corpus
+// embedded in the binary. The files, wherever they are read from, are scanned
+// by workers goroutines.
+func newCorpusReader(retry *retryPolicy, workers int) corpusReader {
+	if dir := os.Getenv("CORPUS_DIR"); dir != "" {
+		slog.Info("reading corpus from local directory", "dir", dir)
+		return func(ctx context.Context, visit func(line string), done func(name string)) (corpusStats, error) {
+			return readLocalFiles(ctx, dir, workers, visit, done)
+		}
+	}
+	if err := probeBucket(context.Background(), bucketName, bucketPrefix); err != nil {
+		slog.Warn("can't reach the bucket, falling back to the embedded corpus", "bucket", bucketName, "prefix", bucketPrefix, "error", err)
+		return func(ctx context.Context, visit func(line string), done func(name string)) (corpusStats, error) {
+			return readEmbeddedFiles(ctx, workers, visit, done)
+		}
+	}
+	slog.Info("reading corpus from Cloud Storage", "bucket", bucketName, "prefix", bucketPrefix)
+	return func(ctx context.Context, visit func(line string), done func(name string)) (corpusStats, error) {
+		return readFiles(ctx, bucketName, bucketPrefix, workers, retry, visit, done)
+	}
+}
+
+// probeBucket checks that the files within the specified bucket with the
+// specified prefix path can be listed.
+func probeBucket(ctx context.Context, bucketName, prefix string) error {
+	ctx, cancel := context.WithTimeout(ctx, bucketProbeTimeout)
+	defer cancel()
+
+	client, err := storage.NewClient(ctx, option.WithoutAuthentication())
+	if err != nil {
+		return fmt.Errorf("failed to create storage client: %s", err)
+	}
+	defer client.Close()
+
+	it := client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	if _, err := it.Next(); err != nil {
+		if err == iterator.Done {
+			return fmt.Errorf("no files in %s starting with %s", bucketName, prefix)
+		}
+		return err
+	}
+	return nil
+}
+
+// readLocalFiles scans the lines of the .txt files in the directory dir. It
+// fails if the directory has no .txt files or if reading any of the files
+// fails.
+func readLocalFiles(ctx context.Context, dir string, workers int, visit func(line string), done func(name string)) (corpusStats, error) {
+	names, err := fs.Glob(os.DirFS(dir), "*.txt")
+	if err != nil {
+		return corpusStats{}, fmt.Errorf("failed to list files in %s: %v", dir, err)
+	}
+	if len(names) == 0 {
+		return corpusStats{}, fmt.Errorf("no .txt files found in %s", dir)
+	}
+	stats, err := scanFiles(ctx, os.DirFS(dir), names, workers, visit, done)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read files in %s: %w", dir, err)
+	}
+	return stats, nil
+}
+
+// readEmbeddedFiles scans the lines of the corpus embedded in the binary.
+func readEmbeddedFiles(ctx context.Context, workers int, visit func(line string), done func(name string)) (corpusStats, error) {
+	names, err := fs.Glob(embeddedCorpus, "corpus/*.txt")
+	if err != nil {
+		return corpusStats{}, fmt.Errorf("failed to list embedded files: %v", err)
+	}
+	stats, err := scanFiles(ctx, embeddedCorpus, names, workers, visit, done)
+	if err != nil {
+		return stats, fmt.Errorf("failed to read embedded files: %w", err)
+	}
+	return stats, nil
+}
+
+// scanFiles calls visit with every line of the files names in fsys, and done,
+// when it isn't nil, with the name of every file once it has been scanned. The
+// files are split into shards that are scanned in parallel by workers
+// goroutines.
+func scanFiles(ctx context.Context, fsys fs.FS, names []string, workers int, visit func(line string), done func(name string)) (corpusStats, error) {
+	shards := splitShards(len(names), workers)
+	partial := make([]corpusStats, len(shards))
+	err := runShards(ctx, shards, func(ctx context.Context, sh shard) error {
+		for _, name := range names[sh.lo:sh.hi] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := scanFile(fsys, name, visit)
+			partial[sh.index].bytes += n
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			partial[sh.index].objects++
+			if done != nil {
+				done(name)
+			}
+		}
+		return nil
+	})
+	var stats corpusStats
+	for _, p := range partial {
+		stats.objects += p.objects
+		stats.bytes += p.bytes
+	}
+	return stats, err
+}
+
+// scanFile calls visit with every line of the file name in fsys and returns
+// the number of bytes read.
+func scanFile(fsys fs.FS, name string, visit func(line string)) (int, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return scanLines(f, visit)
+}
+
+// scanLines calls visit with every line of r and returns the number of bytes
+// read.
+func scanLines(r io.Reader, visit func(line string)) (int, error) {
+	cr := &countingReader{r: r}
+	sc := bufio.NewScanner(cr)
+	sc.Buffer(nil, maxLineLength)
+	for sc.Scan() {
+		visit(sc.Text())
+	}
+	return cr.n, sc.Err()
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// cachedCorpus holds the lines of the corpus in memory. When lower is true,
+// it also holds their lowercased copy, so that the matchers that expect
+// lowercased lines don't lowercase every line of the corpus on every request.
+type cachedCorpus struct {
+	lower      bool
+	lines      []string
+	lowerLines []string
+}
+
+func (c *cachedCorpus) add(line string) {
+	c.lines = append(c.lines, line)
+	if c.lower {
+		c.lowerLines = append(c.lowerLines, strings.ToLower(line))
+	}
+}
+
+// count returns the number of lines that m matches. The lines are split into
+// shards that are matched in parallel by workers goroutines.
+func (c *cachedCorpus) count(ctx context.Context, m matcher, workers int) (int64, error) {
+	lines := c.lines
+	if m.lower {
+		lines = c.lowerLines
+	}
+	shards := splitShards(len(lines), workers)
+	partial := make([]int64, len(shards))
+	err := runShards(ctx, shards, func(ctx context.Context, sh shard) error {
+		var count int64
+		for i, line := range lines[sh.lo:sh.hi] {
+			// stop once the client is gone or the deadline has passed.
+			if i%cancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			if m.match(line) {
+				count++
+			}
+		}
+		partial[sh.index] = count
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Key("matches").Int64(count))
+		return nil
+	})
+	if err != nil {
+		return 0, status.FromContextError(err).Err()
+	}
+	var count int64
+	for _, n := range partial {
+		count += n
+	}
+	return count, nil
+}
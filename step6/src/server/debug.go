@@ -0,0 +1,85 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/reflection"
+)
+
+// startDebugServer serves the handlers of net/http/pprof under /debug/pprof/
+// on PPROF_ADDR, e.g. "localhost:6060", so that the CPU and heap profiles can
+// be taken with `go tool pprof` without Cloud Profiler. It does nothing when
+// PPROF_ADDR is not set. The listener is separate from the gRPC server so that
+// the profiles are never exposed on the port of the service.
+func startDebugServer() error {
+	addr := os.Getenv("PPROF_ADDR")
+	if addr == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("serving pprof", "addr", lis.Addr().String())
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to serve pprof", "error", err)
+		}
+	}()
+	return nil
+}
+
+// startChannelzServer serves the gRPC channelz service on CHANNELZ_ADDR, e.g.
+// "localhost:5051", so that the connections of the server, their streams and
+// their failures can be inspected with grpcdebug or grpcurl. It does nothing
+// when CHANNELZ_ADDR is not set. Like the profiles, channelz is kept off the
+// port of the service.
+func startChannelzServer() error {
+	addr := os.Getenv("CHANNELZ_ADDR")
+	if addr == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	channelz.RegisterChannelzServiceToServer(srv)
+	reflection.Register(srv)
+	slog.Info("serving channelz", "addr", lis.Addr().String())
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			slog.Error("failed to serve channelz", "error", err)
+		}
+	}()
+	return nil
+}
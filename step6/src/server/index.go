@@ -0,0 +1,117 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+
+	"opentelemetry-trace-codelab-go/server/shakesapp"
+)
+
+// wordIndex is an inverted index of the words of the corpus: it maps every
+// word to the numbers of the lines that contain it. The words are the runs of
+// ASCII letters, digits and underscores, which are the word characters of \b,
+// so that the index gives the same counts as matching every line.
+type wordIndex struct {
+	lines int
+	// words indexes the lines as they are, and lowerWords indexes the
+	// lowercased lines for the queries that aren't case sensitive.
+	words      map[string][]int
+	lowerWords map[string][]int
+}
+
+func newWordIndex() *wordIndex {
+	return &wordIndex{
+		words:      map[string][]int{},
+		lowerWords: map[string][]int{},
+	}
+}
+
+// add tokenizes line and indexes it as the next line of the corpus.
+func (x *wordIndex) add(line string) {
+	addWords(x.words, line, x.lines)
+	addWords(x.lowerWords, strings.ToLower(line), x.lines)
+	x.lines++
+}
+
+// addWords adds the line number n to the postings of the words of line.
+func addWords(postings map[string][]int, line string, n int) {
+	start := -1
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && isWordChar(line[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			word := line[start:i]
+			if p := postings[word]; len(p) == 0 || p[len(p)-1] != n {
+				postings[word] = append(p, n)
+			}
+			start = -1
+		}
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// count returns the number of lines that match req, and false when req can't
+// be answered from the index: only the queries made of a single word are.
+func (x *wordIndex) count(req *shakesapp.ShakespeareRequest) (int64, bool) {
+	query, postings := req.Query, x.words
+	if !req.CaseSensitive {
+		query, postings = strings.ToLower(query), x.lowerWords
+	}
+	if query == "" {
+		return 0, false
+	}
+	for i := 0; i < len(query); i++ {
+		if !isWordChar(query[i]) {
+			return 0, false
+		}
+	}
+	switch req.MatchMode {
+	case shakesapp.MatchMode_WHOLE_WORD:
+		return int64(len(postings[query])), true
+	case shakesapp.MatchMode_LITERAL, shakesapp.MatchMode_REGEX:
+		// a word has no metacharacters, so both modes look for the query in
+		// the words of the lines.
+		return x.countContaining(postings, query), true
+	default:
+		return 0, false
+	}
+}
+
+// countContaining returns the number of lines with a word that contains
+// query.
+func (x *wordIndex) countContaining(postings map[string][]int, query string) int64 {
+	seen := make([]bool, x.lines)
+	var count int64
+	for word, lines := range postings {
+		if !strings.Contains(word, query) {
+			continue
+		}
+		for _, n := range lines {
+			if !seen[n] {
+				seen[n] = true
+				count++
+			}
+		}
+	}
+	return count
+}
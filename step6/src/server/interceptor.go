@@ -0,0 +1,139 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// healthMethodPrefix is the prefix of the methods of the health service, which
+// the kubelet calls to probe the server.
+const healthMethodPrefix = "/grpc.health.v1.Health/"
+
+// errorStatusUnaryInterceptor logs the error returned by the handler and
+// records it on the span of the RPC and sets the span status from the gRPC status of the error.
+// It must be chained after the otelgrpc interceptor, which starts the span.
+func errorStatusUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		slog.ErrorContext(ctx, "request failed", "method", info.FullMethod, "error", err)
+		recordStatus(trace.SpanFromContext(ctx), err)
+	}
+	return resp, err
+}
+
+// errorStatusStreamInterceptor is the stream counterpart of
+// errorStatusUnaryInterceptor.
+func errorStatusStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	if err != nil {
+		slog.ErrorContext(ss.Context(), "request failed", "method", info.FullMethod, "error", err)
+		recordStatus(trace.SpanFromContext(ss.Context()), err)
+	}
+	return err
+}
+
+// recordStatus records err on span with the gRPC status code of err.
+func recordStatus(span trace.Span, err error) {
+	s := status.Convert(err)
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, s.Message())
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(s.Code())))
+}
+
+// accessLogUnaryInterceptor logs a line per RPC with its method, peer, the
+// sizes of the request and the response, its gRPC status and its duration.
+// The health checks of the kubelet are logged at the debug level so that they
+// don't flood the logs.
+func accessLogUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logAccess(ctx, info.FullMethod, messageSize(req), messageSize(resp), time.Since(start), err)
+	return resp, err
+}
+
+// accessLogStreamInterceptor is the stream counterpart of
+// accessLogUnaryInterceptor. The sizes are the totals of the messages received
+// and sent on the stream.
+func accessLogStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	cs := &countingServerStream{ServerStream: ss}
+	err := handler(srv, cs)
+	logAccess(ss.Context(), info.FullMethod, cs.recvBytes, cs.sentBytes, time.Since(start), err)
+	return err
+}
+
+func logAccess(ctx context.Context, method string, reqBytes, respBytes int, d time.Duration, err error) {
+	level := slog.LevelInfo
+	if strings.HasPrefix(method, healthMethodPrefix) {
+		level = slog.LevelDebug
+	}
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	slog.Log(ctx, level, "request",
+		"method", method,
+		"peer", addr,
+		"request_bytes", reqBytes,
+		"response_bytes", respBytes,
+		"code", status.Code(err).String(),
+		"duration_ms", float64(d)/float64(time.Millisecond),
+	)
+}
+
+// messageSize returns the size of the wire encoding of m, or 0 if m is not a
+// protobuf message.
+func messageSize(m interface{}) int {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
+
+// countingServerStream counts the bytes of the messages received and sent on
+// the wrapped stream.
+type countingServerStream struct {
+	grpc.ServerStream
+	recvBytes int
+	sentBytes int
+}
+
+func (s *countingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.recvBytes += messageSize(m)
+	}
+	return err
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sentBytes += messageSize(m)
+	}
+	return err
+}
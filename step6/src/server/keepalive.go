@@ -0,0 +1,51 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc/keepalive"
+)
+
+// maxConnectionAgeGrace lets the streams of a connection that is too old
+// finish before it is closed.
+const maxConnectionAgeGrace = 30 * time.Second
+
+// keepaliveParams closes the connections of the clients once they are
+// MAX_CONNECTION_AGE old, a duration such as "5m". The clients that balance
+// their calls over the addresses of the headless Service then resolve it
+// again when they reconnect, so that they find the server pods added since
+// they connected. The connections are kept for as long as the clients want,
+// as gRPC does by default, when it isn't set or is "0".
+func keepaliveParams() (keepalive.ServerParameters, error) {
+	v := os.Getenv("MAX_CONNECTION_AGE")
+	if v == "" {
+		return keepalive.ServerParameters{}, nil
+	}
+	age, err := time.ParseDuration(v)
+	if err != nil || age < 0 {
+		return keepalive.ServerParameters{}, fmt.Errorf("MAX_CONNECTION_AGE must be a duration, got %q", v)
+	}
+	if age == 0 {
+		return keepalive.ServerParameters{}, nil
+	}
+	return keepalive.ServerParameters{
+		MaxConnectionAge:      age,
+		MaxConnectionAgeGrace: maxConnectionAgeGrace,
+	}, nil
+}
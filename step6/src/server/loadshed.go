@@ -0,0 +1,156 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// concurrencyLimiter bounds the number of RPCs handled at once. The RPCs over
+// the bound wait in a queue of bounded length, and the RPCs over the queue are
+// shed with UNAVAILABLE.
+type concurrencyLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+	queued   atomic.Int64
+
+	inFlight   metric.Int64UpDownCounter
+	queueDepth metric.Int64UpDownCounter
+	shed       metric.Int64Counter
+}
+
+// newConcurrencyInterceptors returns the interceptors that handle at most
+// MAX_IN_FLIGHT RPCs at once and queue up to MAX_QUEUED more, which defaults
+// to 0. The unary and the streaming RPCs share the slots, and a streaming RPC
+// holds its slot until the stream ends. It returns nil interceptors when
+// MAX_IN_FLIGHT is not set.
+func newConcurrencyInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor, error) {
+	v := os.Getenv("MAX_IN_FLIGHT")
+	if v == "" {
+		return nil, nil, nil
+	}
+	maxInFlight, err := strconv.Atoi(v)
+	if err != nil || maxInFlight <= 0 {
+		return nil, nil, fmt.Errorf("MAX_IN_FLIGHT must be a positive integer, got %q", v)
+	}
+	maxQueue := 0
+	if v := os.Getenv("MAX_QUEUED"); v != "" {
+		if maxQueue, err = strconv.Atoi(v); err != nil || maxQueue < 0 {
+			return nil, nil, fmt.Errorf("MAX_QUEUED must be a non-negative integer, got %q", v)
+		}
+	}
+
+	meter := otel.Meter("server")
+	inFlight, err := meter.Int64UpDownCounter("shakesapp.server.inflight",
+		metric.WithDescription("Number of requests being handled."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, nil, err
+	}
+	queueDepth, err := meter.Int64UpDownCounter("shakesapp.server.queue.depth",
+		metric.WithDescription("Number of requests waiting for a slot of MAX_IN_FLIGHT."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, nil, err
+	}
+	shed, err := meter.Int64Counter("shakesapp.server.shed",
+		metric.WithDescription("Number of requests rejected because the queue was full."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, nil, err
+	}
+	l := &concurrencyLimiter{
+		slots:      make(chan struct{}, maxInFlight),
+		maxQueue:   int64(maxQueue),
+		inFlight:   inFlight,
+		queueDepth: queueDepth,
+		shed:       shed,
+	}
+	return l.intercept, l.interceptStream, nil
+}
+
+func (l *concurrencyLimiter) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	err = l.run(ctx, info.FullMethod, func() error {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (l *concurrencyLimiter) interceptStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return l.run(ss.Context(), info.FullMethod, func() error {
+		return handler(srv, ss)
+	})
+}
+
+// run calls handle once it has a slot for the RPC method, except for the
+// health checks, which are never queued nor shed.
+func (l *concurrencyLimiter) run(ctx context.Context, method string, handle func() error) error {
+	if strings.HasPrefix(method, healthMethodPrefix) {
+		return handle()
+	}
+	if err := l.acquire(ctx); err != nil {
+		return err
+	}
+	defer func() { <-l.slots }()
+	l.inFlight.Add(ctx, 1)
+	defer l.inFlight.Add(ctx, -1)
+	return handle()
+}
+
+// acquire takes a slot, waiting in the queue when all the slots are taken.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	span := trace.SpanFromContext(ctx)
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		l.shed.Add(ctx, 1)
+		span.AddEvent("load shed")
+		return status.Error(codes.Unavailable, "server is overloaded")
+	}
+	l.queueDepth.Add(ctx, 1)
+	defer func() {
+		l.queued.Add(-1)
+		l.queueDepth.Add(ctx, -1)
+	}()
+	start := time.Now()
+	select {
+	case l.slots <- struct{}{}:
+		span.AddEvent("dequeued", trace.WithAttributes(
+			attribute.Key("wait_ms").Int64(time.Since(start).Milliseconds()),
+		))
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
@@ -16,83 +16,303 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
 	"regexp"
+	"regexp/syntax"
+	"runtime/pprof"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"opentelemetry-trace-codelab-go/internal/telemetry"
 	"opentelemetry-trace-codelab-go/server/shakesapp"
 
 	"cloud.google.com/go/profiler"
 	"cloud.google.com/go/storage"
-	cloudtrace "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/propagation"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 const (
+	serviceName    = "server"
+	serviceVersion = "1.1.0" // step6. update version
+
 	listenPort = "5050"
 
+	// shutdownTimeout bounds the time to drain the in-flight RPCs on SIGTERM,
+	// within the 30s grace period of the pod.
+	shutdownTimeout = 20 * time.Second
+
+	// sharedCountTimeout bounds the count shared by the concurrent requests
+	// for the same query, which outlives the request that started it.
+	sharedCountTimeout = 30 * time.Second
+
 	bucketName   = "dataflow-samples"
 	bucketPrefix = "shakespeare/"
 )
 
 type serverService struct {
 	shakesapp.UnimplementedShakespeareServiceServer
-	healthpb.UnimplementedHealthServer
+	// the health of the server, "", is SERVING as long as the process runs.
+	// The health of ShakespeareService tells whether the corpus can be read.
+	*health.Server
+
+	// reloading serializes the reloads of the corpus.
+	reloading sync.Mutex
+	corpus    atomic.Pointer[corpusReader]
+	index     atomic.Pointer[wordIndex]
+	cache     atomic.Pointer[cachedCorpus]
+	// generation is incremented by every reload of the corpus, after the
+	// corpus is stored, and keys the cached results with the corpus that
+	// they were counted from.
+	generation atomic.Uint64
+	inflight   singleflight.Group
+	shared     sharedSpans
+	results    *resultCache
+	patterns   *patternCache
+	retry      *retryPolicy
+	metrics    *serverMetrics
+
+	// workers is the number of goroutines that match the corpus in parallel.
+	workers int
+	// lowercaseLines makes the queries that aren't case sensitive lowercase
+	// the lines instead of matching them with a case-insensitive regexp.
+	lowercaseLines bool
+}
+
+func NewServerService() (*serverService, error) {
+	metrics, err := newServerMetrics()
+	if err != nil {
+		return nil, err
+	}
+	retry, err := newRetryPolicy(metrics.gcsRetries)
+	if err != nil {
+		return nil, err
+	}
+	results, err := newResultCache(metrics.cacheLookups)
+	if err != nil {
+		return nil, err
+	}
+	workers, err := matchWorkers()
+	if err != nil {
+		return nil, err
+	}
+	lowercaseLines, _ := strconv.ParseBool(os.Getenv("MATCH_LOWERCASE"))
+	s := &serverService{
+		Server:         health.NewServer(),
+		results:        results,
+		patterns:       newPatternCache(),
+		retry:          retry,
+		metrics:        metrics,
+		workers:        workers,
+		lowercaseLines: lowercaseLines,
+	}
+	s.setReady(false)
+	go s.loadCorpus()
+	return s, nil
+}
+
+// loadCorpus selects the source of the corpus, which may take up to
+// bucketProbeTimeout, and then reports ShakespeareService as SERVING.
+func (s *serverService) loadCorpus() {
+	if err := s.reloadCorpus(); err != nil {
+		slog.Warn("failed to read the corpus, matching without the index and the cache", "error", err)
+	}
+	s.setReady(true)
+}
+
+// reloadCorpus selects the source of the corpus again, rebuilds the index and
+// the cache, when they are enabled, and then starts a new generation of the
+// cached results. The requests keep matching the previous corpus until it is
+// done, so ShakespeareService stays SERVING during the reload. When the corpus
+// can't be read, the requests keep matching the previous corpus, or, at
+// startup, read it on every request, without the index and the cache.
+func (s *serverService) reloadCorpus() error {
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+	readCorpus := newCorpusReader(s.retry, s.workers)
+	useIndex, _ := strconv.ParseBool(os.Getenv("MATCH_INDEX"))
+	useCache, _ := strconv.ParseBool(os.Getenv("CORPUS_CACHE"))
+	var index *wordIndex
+	var cache *cachedCorpus
+	var err error
+	if useIndex || useCache {
+		index, cache, err = s.preload(readCorpus, useIndex, useCache)
+		if err != nil && s.corpus.Load() != nil {
+			return err
+		}
+	}
+	s.corpus.Store(&readCorpus)
+	s.index.Store(index)
+	s.cache.Store(cache)
+	// the results of the previous corpus are left to be evicted from the
+	// cache.
+	s.generation.Add(1)
+	return err
+}
+
+// preload reads the corpus once to build the index that answers the single
+// word queries when useIndex is true, and to keep the corpus in memory when
+// useCache is true. The other queries still scan the corpus, from memory when
+// it is cached.
+func (s *serverService) preload(readCorpus corpusReader, useIndex, useCache bool) (*wordIndex, *cachedCorpus, error) {
+	start := time.Now()
+	var index *wordIndex
+	if useIndex {
+		index = newWordIndex()
+	}
+	var cache *cachedCorpus
+	if useCache {
+		cache = &cachedCorpus{lower: s.lowercaseLines}
+	}
+	var mu sync.Mutex
+	_, err := readCorpus(context.Background(), func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if index != nil {
+			index.add(line)
+		}
+		if cache != nil {
+			cache.add(line)
+		}
+	}, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if index != nil {
+		slog.Info("built the word index", "lines", index.lines, "words", len(index.words), "duration_ms", time.Since(start).Milliseconds())
+	}
+	if cache != nil {
+		slog.Info("cached the corpus", "lines", len(cache.lines), "duration_ms", time.Since(start).Milliseconds())
+	}
+	return index, cache, nil
 }
 
-func NewServerService() *serverService {
-	return &serverService{}
+// setReady sets the health of ShakespeareService, which the readiness probe
+// of the pod checks, and notifies the Watch streams of the change.
+func (s *serverService) setReady(ready bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	s.SetServingStatus(shakesapp.ShakespeareService_ServiceDesc.ServiceName, st)
 }
 
 // step2. add OpenTelemetry initialization function
 func initTracer() (*sdktrace.TracerProvider, error) {
-	// step3. replace stdout exporter with Cloud Trace exporter
-	// cloudtrace.New() finds the credentials to Cloud Trace automatically following the
-	// rules defined by golang.org/x/oauth2/google.findDefaultCredentailsWithParams.
-	// https://pkg.go.dev/golang.org/x/oauth2/google#FindDefaultCredentialsWithParams
-	exporter, err := cloudtrace.New()
-	// step3. end replacing exporter
+	exporter, err := telemetry.NewExporter(context.Background())
 	if err != nil {
 		return nil, err
 	}
-	// for the demonstration, we use AlwaysSmaple sampler to take all spans.
-	// do not use this option in production.
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exporter),
-	)
+	// for the demonstration, NewSampler returns AlwaysSample sampler to take all
+	// spans unless OTEL_TRACES_SAMPLER is set.
+	sampler, err := telemetry.NewSampler()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := telemetry.NewSpanLimits()
+	if err != nil {
+		return nil, err
+	}
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	prop, err := telemetry.NewPropagator()
+	if err != nil {
+		return nil, err
+	}
+	batcher, err := telemetry.NewBatchSpanProcessor(exporter)
+	if err != nil {
+		return nil, err
+	}
+	// hash the raw queries before they are exported.
+	redaction, err := telemetry.NewRedactionProcessor(batcher)
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithRawSpanLimits(limits),
+		// drop the spans of the kubelet probes before they are exported.
+		sdktrace.WithSpanProcessor(telemetry.NewHealthCheckFilter(redaction)),
+	}
+	// stamp the baggage of the client, such as its request ID, on the spans.
+	if bp := telemetry.NewBaggageSpanProcessor(); bp != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(bp))
+	}
+	zp, err := telemetry.NewZPages()
+	if err != nil {
+		return nil, err
+	}
+	if zp != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(zp))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetTextMapPropagator(prop)
 	return tp, nil
 }
 
+// initMeter sets the global MeterProvider that exports the metrics of the
+// server next to its spans.
+func initMeter() (*sdkmetric.MeterProvider, error) {
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	mp, err := telemetry.NewMeterProvider(context.Background(), res)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetMeterProvider(mp)
+	return mp, nil
+}
+
+// initLogger creates the LoggerProvider that exports the log records of the
+// server next to its spans.
+func initLogger() (*sdklog.LoggerProvider, error) {
+	res, err := telemetry.NewResource(context.Background(), serviceName, serviceVersion)
+	if err != nil {
+		return nil, err
+	}
+	return telemetry.NewLoggerProvider(context.Background(), res)
+}
+
 // step2: end OpenTelemetry initialization function
 
 // step5: add Profiler initializer
 func initProfiler() {
-	cfg := profiler.Config{
-		Service:              "server",
-		ServiceVersion:       "1.1.0", // step6. update version
-		NoHeapProfiling:      true,
-		NoAllocProfiling:     true,
-		NoGoroutineProfiling: true,
-		NoCPUProfiling:       false,
+	cfg, err := profilerConfig()
+	if err != nil {
+		fatal("failed to configure profiler agent", "error", err)
 	}
 	if err := profiler.Start(cfg); err != nil {
-		log.Fatalf("failed to launch profiler agent: %v", err)
+		fatal("failed to launch profiler agent", "error", err)
 	}
 }
 
@@ -100,6 +320,25 @@ func initProfiler() {
 
 // TODO: instrument the application with Cloud Profiler agent
 func main() {
+	slog.SetDefault(telemetry.NewLogger(serviceName, nil))
+	// size the Go runtime to the container before the resources are created,
+	// so that they carry its memory limit.
+	slog.Info("configured the Go runtime",
+		"gomaxprocs", telemetry.SetMaxProcs(),
+		"gomemlimit", telemetry.SetMemoryLimit(),
+	)
+
+	lp, err := initLogger()
+	if err != nil {
+		fatal("failed to initialize LoggerProvider", "error", err)
+	}
+	defer func() {
+		if err := lp.Shutdown(context.Background()); err != nil {
+			fatal("failed to shut down LoggerProvider", "error", err)
+		}
+	}()
+	slog.SetDefault(telemetry.NewLogger(serviceName, lp))
+
 	port := listenPort
 	if os.Getenv("PORT") != "" {
 		port = os.Getenv("PORT")
@@ -107,90 +346,367 @@ func main() {
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
 	if err != nil {
-		log.Fatalf("error %v; error listening port %v", err, port)
+		fatal("failed to listen", "port", port, "error", err)
 	}
 
 	// step2. setup OpenTelemetry
 	tp, err := initTracer()
 	if err != nil {
-		log.Fatalf("failed to initialize TracerProvider: %v", err)
+		fatal("failed to initialize TracerProvider", "error", err)
 	}
 	defer func() {
 		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Fatalf("error shutting down TracerProvider: %v", err)
+			fatal("failed to shut down TracerProvider", "error", err)
 		}
 	}()
 	// step2. end setup
 
+	mp, err := initMeter()
+	if err != nil {
+		fatal("failed to initialize MeterProvider", "error", err)
+	}
+	defer func() {
+		if err := mp.Shutdown(context.Background()); err != nil {
+			fatal("failed to shut down MeterProvider", "error", err)
+		}
+	}()
+
 	// step5. start profiler
 	go initProfiler()
 	// step5. end
+	if err := startDebugServer(); err != nil {
+		fatal("failed to start the pprof server", "error", err)
+	}
+	if err := startChannelzServer(); err != nil {
+		fatal("failed to start the channelz server", "error", err)
+	}
 
-	svc := NewServerService()
+	svc, err := NewServerService()
+	if err != nil {
+		fatal("failed to create server service", "error", err)
+	}
+	if err := startAdminServer(svc); err != nil {
+		fatal("failed to start the admin server", "error", err)
+	}
+	creds, err := serverCredentials()
+	if err != nil {
+		fatal("failed to configure TLS", "error", err)
+	}
+	recoveryUnary, recoveryStream := newRecoveryInterceptors()
+	unary := []grpc.UnaryServerInterceptor{requestIDUnaryInterceptor, accessLogUnaryInterceptor, errorStatusUnaryInterceptor, recoveryUnary}
+	stream := []grpc.StreamServerInterceptor{requestIDStreamInterceptor, accessLogStreamInterceptor, errorStatusStreamInterceptor, recoveryStream}
+	// the auth check and the rate and concurrency limiters are chained after
+	// errorStatus so that the rejected RPCs are recorded on their spans. The
+	// auth check comes first, so that the unauthenticated RPCs don't take the
+	// tokens of the rate limiter from the authenticated clients.
+	if token := os.Getenv("AUTH_TOKEN"); token != "" {
+		authUnary, authStream := authInterceptors(token)
+		unary = append(unary, authUnary)
+		stream = append(stream, authStream)
+	}
+	rateLimitUnary, rateLimitStream, err := newRateLimitInterceptors()
+	if err != nil {
+		fatal("failed to configure rate limiting", "error", err)
+	}
+	if rateLimitUnary != nil {
+		unary = append(unary, rateLimitUnary)
+		stream = append(stream, rateLimitStream)
+	}
+	concurrencyUnary, concurrencyStream, err := newConcurrencyInterceptors()
+	if err != nil {
+		fatal("failed to configure concurrency limiting", "error", err)
+	}
+	if concurrencyUnary != nil {
+		unary = append(unary, concurrencyUnary)
+		stream = append(stream, concurrencyStream)
+	}
+	kp, err := keepaliveParams()
+	if err != nil {
+		fatal("failed to configure keepalive", "error", err)
+	}
 	// step2: add interceptor
-	interceptorOpt := otelgrpc.WithTracerProvider(otel.GetTracerProvider())
+	handlerOpt := otelgrpc.WithTracerProvider(otel.GetTracerProvider())
 	srv := grpc.NewServer(
-		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor(interceptorOpt)),
-		grpc.StreamInterceptor(otelgrpc.StreamServerInterceptor(interceptorOpt)),
+		grpc.Creds(creds),
+		grpc.KeepaliveParams(kp),
+		grpc.StatsHandler(otelgrpc.NewServerHandler(handlerOpt)),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 	)
 	// step2: end adding interceptor
 	shakesapp.RegisterShakespeareServiceServer(srv, svc)
 	healthpb.RegisterHealthServer(srv, svc)
+	// let grpcurl list and call the services without the proto files.
+	reflection.Register(srv)
+
+	// stop accepting RPCs on SIGTERM, and let the deferred calls flush the
+	// telemetry once the in-flight RPCs are drained.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		slog.Info("shutting down", "timeout", shutdownTimeout.String())
+		// report NOT_SERVING so that the pod is removed from the endpoints.
+		svc.Shutdown()
+		gracefulStop(srv, shutdownTimeout)
+	}()
 	if err := srv.Serve(lis); err != nil {
-		log.Fatalf("error serving server: %v", err)
+		fatal("failed to serve", "error", err)
 	}
+	<-stopped
 }
 
-// GetMatchCount implements a server for ShakespeareService.
+// gracefulStop stops srv once the in-flight RPCs are done, or cancels them
+// after timeout.
+func gracefulStop(srv *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Warn("drain timed out, cancelling in-flight RPCs", "timeout", timeout.String())
+		srv.Stop()
+	}
+}
+
+// fatal logs msg with the key-value pairs in args as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// GetMatchCount implements a server for ShakespeareService. The profiles
+// taken while it runs are labeled with the trace context of the request.
 //
 // TODO: instrument the application to take the latency of the request to Cloud Storage
-func (s *serverService) GetMatchCount(ctx context.Context, req *shakesapp.ShakespeareRequest) (*shakesapp.ShakespeareResponse, error) {
-	resp := &shakesapp.ShakespeareResponse{}
-	texts, err := readFiles(ctx, bucketName, bucketPrefix)
-	if err != nil {
-		return resp, fmt.Errorf("fails to read files: %s", err)
-	}
+func (s *serverService) GetMatchCount(ctx context.Context, req *shakesapp.ShakespeareRequest) (resp *shakesapp.ShakespeareResponse, err error) {
+	pprof.Do(ctx, profileLabels(ctx, "GetMatchCount", req.MatchMode), func(ctx context.Context) {
+		resp, err = s.getMatchCount(ctx, req)
+	})
+	return resp, err
+}
+
+func (s *serverService) getMatchCount(ctx context.Context, req *shakesapp.ShakespeareRequest) (resp *shakesapp.ShakespeareResponse, err error) {
+	resp = &shakesapp.ShakespeareResponse{}
+	start := time.Now()
+	defer func() {
+		s.metrics.recordRequest(ctx, "GetMatchCount", req.MatchMode, time.Since(start), err)
+	}()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Key("match_mode").String(req.MatchMode.String()),
+		attribute.Key("case_sensitive").Bool(req.CaseSensitive),
+	)
 
 	// step6. considered the process carefully and naively tuned up by extracting
 	// regexp pattern compile process out of for loop.
-	query := strings.ToLower(req.Query)
-	re := regexp.MustCompile(query)
-	for _, text := range texts {
-		for _, line := range strings.Split(text, "\n") {
-			line = strings.ToLower(line)
-			isMatch := re.MatchString(line)
-			// step6. done replacing regexp with strings
-			if isMatch {
-				resp.MatchCount++
+	match, err := newMatcher(ctx, req, s.patterns, s.lowercaseLines)
+	if err != nil {
+		// the query is left out, so that it isn't exported with the status of
+		// the span.
+		return resp, status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+
+	// the generation is loaded before the corpus, so that a count of the
+	// previous corpus is never cached with the generation of the new one.
+	generation := s.generation.Load()
+	readCorpus := s.corpus.Load()
+	if readCorpus == nil {
+		return resp, status.Error(codes.Unavailable, "corpus is not ready")
+	}
+	if index := s.index.Load(); index != nil {
+		if count, ok := index.count(req); ok {
+			span.SetAttributes(attribute.Key("index").Bool(true))
+			resp.MatchCount = count
+			return resp, nil
+		}
+	}
+	key := fmt.Sprintf("%d/%s", generation, queryKey(req))
+	if count, ok := s.results.get(ctx, key); ok {
+		span.SetAttributes(attribute.Key("result_cache.hit").Bool(true))
+		resp.MatchCount = count
+		return resp, nil
+	}
+	// the concurrent requests for the same query share the count of the first
+	// one, the leader. The count isn't canceled with the request of the
+	// leader, so that the others still get it when the leader is gone, and
+	// every request only waits for it until its own context is done. The
+	// count has a span of its own, linked to the requests that share it.
+	leader := false
+	results := s.inflight.DoChan(key, func() (_ interface{}, err error) {
+		leader = true
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedCountTimeout)
+		defer cancel()
+		ctx, end := s.shared.start(ctx, key)
+		defer end()
+		defer func() {
+			if err != nil {
+				spanError(trace.SpanFromContext(ctx), err)
 			}
+		}()
+		// singleflight panics again in a goroutine of its own, which would
+		// crash the server, when the count panics.
+		defer recoverPanic(ctx, "GetMatchCount.shared", &err)
+		count, err := s.countMatches(ctx, *readCorpus, match)
+		if err == nil {
+			s.results.add(key, count)
 		}
+		return count, err
+	})
+	s.shared.link(ctx, key)
+	var r singleflight.Result
+	select {
+	case r = <-results:
+	case <-ctx.Done():
+		return resp, status.FromContextError(ctx.Err()).Err()
+	}
+	span.SetAttributes(
+		attribute.Key("singleflight.leader").Bool(leader),
+		attribute.Key("singleflight.shared").Bool(r.Shared),
+	)
+	if r.Err != nil {
+		return resp, r.Err
 	}
+	resp.MatchCount = r.Val.(int64)
 	return resp, nil
 }
 
-// readFiles reads the content of files within the specified bucket with the
-// specified prefix path in parallel and returns their content. It fails if
-// operations to find or read any of the files fails.
-func readFiles(ctx context.Context, bucketName, prefix string) ([]string, error) {
-	type resp struct {
-		s   string
-		err error
+// countMatches reads the corpus with readCorpus and returns the number of its
+// lines that m matches.
+func (s *serverService) countMatches(ctx context.Context, readCorpus corpusReader, m matcher) (int64, error) {
+	if cache := s.cache.Load(); cache != nil {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Key("corpus_cache").Bool(true))
+		return cache.count(ctx, m, s.workers)
+	}
+	// the lines are matched as they are read, instead of holding the whole
+	// corpus in memory.
+	var count atomic.Int64
+	readStart := time.Now()
+	stats, err := readCorpus(ctx, func(line string) {
+		if m.lower {
+			line = strings.ToLower(line)
+		}
+		isMatch := m.match(line)
+		// step6. done replacing regexp with strings
+		if isMatch {
+			count.Add(1)
+		}
+	}, nil)
+	s.metrics.recordRead(ctx, time.Since(readStart), stats)
+	if err != nil {
+		// stop once the client is gone or the deadline has passed.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, status.FromContextError(ctxErr).Err()
+		}
+		return 0, fmt.Errorf("fails to read files: %w", err)
+	}
+	return count.Load(), nil
+}
+
+// queryKey returns a key that is equal for the requests that have the same
+// count: the query is lowercased unless req is case sensitive.
+func queryKey(req *shakesapp.ShakespeareRequest) string {
+	query := req.Query
+	if !req.CaseSensitive {
+		query = strings.ToLower(query)
 	}
+	return fmt.Sprintf("%s/%t/%s", req.MatchMode, req.CaseSensitive, query)
+}
+
+// matcher reports whether a line matches a query. When lower is true, match
+// expects lowercased lines.
+type matcher struct {
+	match func(line string) bool
+	lower bool
+}
+
+// newMatcher returns the matcher of the query of req in its match mode. Unless
+// req is case sensitive, the matcher compiles the query as a case-insensitive
+// regular expression and matches the lines as they are. With lowercaseLines,
+// the matcher lowercases the query instead and expects lowercased lines, so
+// that both ways can be compared in Cloud Profiler. The regular expressions
+// are compiled once in patterns, and the span of ctx records whether the
+// pattern was cached and how long it took to get it.
+func newMatcher(ctx context.Context, req *shakesapp.ShakespeareRequest, patterns *patternCache, lowercaseLines bool) (matcher, error) {
+	var m matcher
+	query := req.Query
+	foldCase := false
+	if !req.CaseSensitive {
+		if lowercaseLines {
+			query = strings.ToLower(query)
+			m.lower = true
+		} else {
+			foldCase = true
+		}
+	}
+	switch req.MatchMode {
+	case shakesapp.MatchMode_LITERAL:
+		if !foldCase {
+			m.match = func(line string) bool {
+				return strings.Contains(line, query)
+			}
+			return m, nil
+		}
+		query = regexp.QuoteMeta(query)
+	case shakesapp.MatchMode_WHOLE_WORD:
+		query = `\b` + regexp.QuoteMeta(query) + `\b`
+	case shakesapp.MatchMode_REGEX:
+	default:
+		return m, fmt.Errorf("unknown match mode %v", req.MatchMode)
+	}
+	if foldCase {
+		query = "(?i)" + query
+	}
+	start := time.Now()
+	re, cached, err := patterns.compile(query)
+	if err != nil {
+		// the errors of regexp quote the pattern, which is the raw query.
+		var serr *syntax.Error
+		if errors.As(err, &serr) {
+			return m, fmt.Errorf("invalid regexp: %s", serr.Code)
+		}
+		return m, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Key("regexp.cached").Bool(cached),
+		attribute.Key("regexp.compile_us").Int64(time.Since(start).Microseconds()),
+	)
+	m.match = re.MatchString
+	return m, nil
+}
+
+// readFiles reads the files within the specified bucket with the specified
+// prefix path and calls visit with their lines as they are downloaded, and
+// done, when it isn't nil, with the path of every file once it has been read.
+// The files are split into shards that are downloaded in parallel by workers
+// goroutines. It fails if operations to find or read any of the files fails.
+//
+// The listing and the reads are retried on transient errors with retry.
+func readFiles(ctx context.Context, bucketName, prefix string, workers int, retry *retryPolicy, visit func(line string), done func(name string)) (corpusStats, error) {
+	var stats corpusStats
 
 	// step4: add an extra span
-	span := trace.SpanFromContext(ctx)
-	span.SetName("server.readFiles")
-	span.SetAttributes(attribute.Key("bucketname").String(bucketName))
+	tr := otel.Tracer("server")
+	ctx, span := tr.Start(ctx, "server.readFiles", trace.WithAttributes(
+		attribute.Key("bucketname").String(bucketName),
+	))
 	defer span.End()
 	// step4: end add span
 
+	// runShards waits for the downloads, so the client is closed once they
+	// are done.
 	client, err := storage.NewClient(ctx, option.WithoutAuthentication())
 	if err != nil {
-		return []string{}, fmt.Errorf("failed to create storage client: %s", err)
+		return stats, spanError(span, fmt.Errorf("failed to create storage client: %s", err))
 	}
 	defer client.Close()
 
-	bucket := client.Bucket(bucketName)
+	bucket := client.Bucket(bucketName).Retryer(retry.options(ctx, span)...)
 
 	var paths []string
 	it := bucket.Objects(ctx, &storage.Query{Prefix: bucketPrefix})
@@ -200,43 +716,84 @@ func readFiles(ctx context.Context, bucketName, prefix string) ([]string, error)
 			break
 		}
 		if err != nil {
-			return []string{}, fmt.Errorf("failed to iterate over files in %s starting with %s: %v", bucketName, prefix, err)
+			return stats, spanError(span, fmt.Errorf("failed to iterate over files in %s starting with %s: %v", bucketName, prefix, err))
 		}
 		if attrs.Name != "" {
 			paths = append(paths, attrs.Name)
 		}
 	}
+	span.AddEvent("listing complete", trace.WithAttributes(
+		attribute.Key("objects").Int(len(paths)),
+	))
+	span.SetAttributes(attribute.Key("objects").Int(len(paths)))
 
-	resps := make(chan resp)
-	for _, path := range paths {
-		go func(path string) {
-			obj := bucket.Object(path)
-			r, err := obj.NewReader(ctx)
+	shards := splitShards(len(paths), workers)
+	partial := make([]corpusStats, len(shards))
+	err = runShards(ctx, shards, func(ctx context.Context, sh shard) error {
+		for _, path := range paths[sh.lo:sh.hi] {
+			// stop once the request is cancelled or another shard has failed.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := readObject(ctx, bucket, path, retry, visit)
+			partial[sh.index].bytes += n
 			if err != nil {
-				resps <- resp{"", err}
+				return err
+			}
+			partial[sh.index].objects++
+			if done != nil {
+				done(path)
 			}
-			defer r.Close()
-			data, err := ioutil.ReadAll(r)
-			resps <- resp{string(data), err}
-		}(path)
-	}
-	ret := make([]string, len(paths))
-	for i := 0; i < len(paths); i++ {
-		r := <-resps
-		if r.err != nil {
-			err = r.err
 		}
-		ret[i] = r.s
+		return nil
+	})
+	for _, p := range partial {
+		stats.objects += p.objects
+		stats.bytes += p.bytes
 	}
-	return ret, err
+	// the bytes downloaded from the bucket, which dominate the latency of the
+	// request.
+	span.SetAttributes(attribute.Key("bytes").Int(stats.bytes))
+	if err != nil {
+		return stats, spanError(span, err)
+	}
+	span.AddEvent("download complete", trace.WithAttributes(
+		attribute.Key("bytes").Int(stats.bytes),
+	))
+	return stats, nil
 }
 
-// Check is for health checking.
-func (s *serverService) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
-	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+// readObject calls visit with every line of the object path of bucket, within
+// a server.readFile span, and returns the number of bytes read.
+func readObject(ctx context.Context, bucket *storage.BucketHandle, path string, retry *retryPolicy, visit func(line string)) (n int, err error) {
+	ctx, span := otel.Tracer("server").Start(ctx, "server.readFile", trace.WithAttributes(
+		attribute.Key("object").String(path),
+	))
+	defer span.End()
+	start := time.Now()
+	defer func() {
+		span.SetAttributes(
+			attribute.Key("bytes").Int(n),
+			attribute.Key("duration_ms").Int64(time.Since(start).Milliseconds()),
+		)
+	}()
+
+	obj := bucket.Object(path).Retryer(retry.options(ctx, span)...)
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		return 0, spanError(span, err)
+	}
+	defer r.Close()
+	n, err = scanLines(r, visit)
+	if err != nil {
+		return n, spanError(span, err)
+	}
+	return n, nil
 }
 
-// Watch is for health checking.
-func (s *serverService) Watch(req *healthpb.HealthCheckRequest, server healthpb.Health_WatchServer) error {
-	return nil
+// spanError records err on span, marks span as failed and returns err.
+func spanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(otelcodes.Error, err.Error())
+	return err
 }
@@ -0,0 +1,122 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"opentelemetry-trace-codelab-go/server/shakesapp"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"google.golang.org/grpc/status"
+)
+
+// durationBuckets are the bucket boundaries, in seconds, of the latency
+// histograms. Each bucket keeps the trace ID of a request that fell in it as an
+// exemplar, so that a latency spike leads to the trace of a slow request.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// serverMetrics holds the instruments recorded by GetMatchCount.
+type serverMetrics struct {
+	requests     metric.Int64Counter
+	duration     metric.Float64Histogram
+	readDuration metric.Float64Histogram
+	readBytes    metric.Int64Counter
+	readObjects  metric.Int64Counter
+	gcsRetries   metric.Int64Counter
+	cacheLookups metric.Int64Counter
+}
+
+func newServerMetrics() (*serverMetrics, error) {
+	meter := otel.Meter("server")
+	requests, err := meter.Int64Counter("shakesapp.server.requests",
+		metric.WithDescription("Number of GetMatchCount and GetMatchCounts requests."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("shakesapp.server.request.duration",
+		metric.WithDescription("Duration of the GetMatchCount and GetMatchCounts requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	readDuration, err := meter.Float64Histogram("shakesapp.server.corpus.read.duration",
+		metric.WithDescription("Duration of reading the corpus, from Cloud Storage unless CORPUS_DIR is set or the bucket is unreachable."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	readBytes, err := meter.Int64Counter("shakesapp.server.corpus.read.bytes",
+		metric.WithDescription("Number of bytes of the corpus read by the GetMatchCount requests."),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	readObjects, err := meter.Int64Counter("shakesapp.server.corpus.read.objects",
+		metric.WithDescription("Number of corpus files read by the GetMatchCount requests."),
+		metric.WithUnit("{object}"))
+	if err != nil {
+		return nil, err
+	}
+	gcsRetries, err := meter.Int64Counter("shakesapp.server.gcs.retries",
+		metric.WithDescription("Number of Cloud Storage operations retried after a transient error."),
+		metric.WithUnit("{retry}"))
+	if err != nil {
+		return nil, err
+	}
+	cacheLookups, err := meter.Int64Counter("shakesapp.server.result_cache.lookups",
+		metric.WithDescription("Number of lookups in the result cache, by hit."),
+		metric.WithUnit("{lookup}"))
+	if err != nil {
+		return nil, err
+	}
+	return &serverMetrics{
+		requests:     requests,
+		duration:     duration,
+		readDuration: readDuration,
+		readBytes:    readBytes,
+		readObjects:  readObjects,
+		gcsRetries:   gcsRetries,
+		cacheLookups: cacheLookups,
+	}, nil
+}
+
+// recordRequest records a request of method in mode that took d and returned
+// err. ctx must hold the span of the request to attach its trace ID as an
+// exemplar.
+func (m *serverMetrics) recordRequest(ctx context.Context, method string, mode shakesapp.MatchMode, d time.Duration, err error) {
+	attrs := metric.WithAttributes(
+		semconv.RPCMethodKey.String(method),
+		attribute.Key("match_mode").String(mode.String()),
+		semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))),
+	)
+	m.requests.Add(ctx, 1, attrs)
+	m.duration.Record(ctx, d.Seconds(), attrs)
+}
+
+// recordRead records the time taken to read the corpus, and the number and
+// the size of the texts that were read.
+func (m *serverMetrics) recordRead(ctx context.Context, d time.Duration, stats corpusStats) {
+	m.readDuration.Record(ctx, d.Seconds())
+	m.readObjects.Add(ctx, int64(stats.objects))
+	m.readBytes.Add(ctx, int64(stats.bytes))
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"regexp"
+	"sync"
+)
+
+// maxCachedPatterns bounds the number of patterns in a patternCache, so that
+// arbitrary queries can't grow it without limit.
+const maxCachedPatterns = 1024
+
+// patternCache keeps the compiled regular expressions of the queries, so that
+// the queries repeated by the loadgen are compiled once.
+type patternCache struct {
+	mu       sync.RWMutex
+	patterns map[string]*regexp.Regexp
+}
+
+func newPatternCache() *patternCache {
+	return &patternCache{patterns: map[string]*regexp.Regexp{}}
+}
+
+// flush removes all the patterns and returns their number.
+func (c *patternCache) flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.patterns)
+	clear(c.patterns)
+	return n
+}
+
+// compile returns the compiled pattern and whether it was found in the cache.
+func (c *patternCache) compile(pattern string) (*regexp.Regexp, bool, error) {
+	c.mu.RLock()
+	re, ok := c.patterns[pattern]
+	c.mu.RUnlock()
+	if ok {
+		return re, true, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	c.mu.Lock()
+	if len(c.patterns) < maxCachedPatterns {
+		c.patterns[pattern] = re
+	}
+	c.mu.Unlock()
+	return re, false, nil
+}
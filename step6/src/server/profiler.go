@@ -0,0 +1,96 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+
+	"opentelemetry-trace-codelab-go/server/shakesapp"
+
+	"cloud.google.com/go/profiler"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// profilerConfig returns the configuration of the Cloud Profiler agent.
+// PROFILER_SERVICE and PROFILER_VERSION override the name and the version of
+// the service, which default to the server and to the version of its module,
+// or serviceVersion when the binary doesn't carry one. PROFILER_CPU,
+// PROFILER_HEAP, PROFILER_ALLOC, PROFILER_GOROUTINE and PROFILER_MUTEX enable
+// or disable each profile type; only the CPU profile is collected by default.
+func profilerConfig() (profiler.Config, error) {
+	cfg := profiler.Config{
+		Service:        serviceName,
+		ServiceVersion: buildVersion(),
+	}
+	if v := os.Getenv("PROFILER_SERVICE"); v != "" {
+		cfg.Service = v
+	}
+	if v := os.Getenv("PROFILER_VERSION"); v != "" {
+		cfg.ServiceVersion = v
+	}
+	profiles := []struct {
+		env     string
+		enabled bool
+		set     func(enabled bool)
+	}{
+		{"PROFILER_CPU", true, func(b bool) { cfg.NoCPUProfiling = !b }},
+		{"PROFILER_HEAP", false, func(b bool) { cfg.NoHeapProfiling = !b }},
+		{"PROFILER_ALLOC", false, func(b bool) { cfg.NoAllocProfiling = !b }},
+		{"PROFILER_GOROUTINE", false, func(b bool) { cfg.NoGoroutineProfiling = !b }},
+		{"PROFILER_MUTEX", false, func(b bool) { cfg.MutexProfiling = b }},
+	}
+	for _, p := range profiles {
+		enabled := p.enabled
+		if v := os.Getenv(p.env); v != "" {
+			var err error
+			enabled, err = strconv.ParseBool(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s must be a boolean, got %q", p.env, v)
+			}
+		}
+		p.set(enabled)
+	}
+	return cfg, nil
+}
+
+// profileLabels returns the pprof labels of a request of method in mode. The
+// trace_id and span_id labels hold the span of ctx, so that the samples of the
+// request can be filtered in Cloud Profiler from its trace in Cloud Trace.
+// The goroutines started by the request inherit the labels.
+func profileLabels(ctx context.Context, method string, mode shakesapp.MatchMode) pprof.LabelSet {
+	sc := trace.SpanContextFromContext(ctx)
+	return pprof.Labels(
+		"rpc", method,
+		"match_mode", mode.String(),
+		"trace_id", sc.TraceID().String(),
+		"span_id", sc.SpanID().String(),
+	)
+}
+
+// buildVersion returns the version of the main module recorded in the
+// binary, or serviceVersion when the binary was built from a local checkout.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			return v
+		}
+	}
+	return serviceVersion
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newRateLimitInterceptors returns the interceptors that reject the RPCs over
+// RATE_LIMIT_RPS requests per second with RESOURCE_EXHAUSTED, so that the
+// loadgen gets backpressure instead of piling up requests on the server.
+// RATE_LIMIT_BURST is the size of the token bucket and defaults to one second
+// of requests. The unary and the streaming RPCs share the bucket, and a stream
+// takes a single token when it starts. It returns nil interceptors when
+// RATE_LIMIT_RPS is not set.
+func newRateLimitInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor, error) {
+	v := os.Getenv("RATE_LIMIT_RPS")
+	if v == "" {
+		return nil, nil, nil
+	}
+	rps, err := strconv.ParseFloat(v, 64)
+	if err != nil || rps <= 0 {
+		return nil, nil, fmt.Errorf("RATE_LIMIT_RPS must be a positive number, got %q", v)
+	}
+	burst := int(math.Max(1, math.Ceil(rps)))
+	if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+		if burst, err = strconv.Atoi(v); err != nil || burst <= 0 {
+			return nil, nil, fmt.Errorf("RATE_LIMIT_BURST must be a positive integer, got %q", v)
+		}
+	}
+	rejected, err := otel.Meter("server").Int64Counter("shakesapp.server.rate_limited",
+		metric.WithDescription("Number of requests rejected by the rate limiter."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(rps), burst)
+	// allow returns the error of the RPC method when it is over the rate.
+	allow := func(ctx context.Context, method string) error {
+		if strings.HasPrefix(method, healthMethodPrefix) || limiter.Allow() {
+			return nil
+		}
+		trace.SpanFromContext(ctx).AddEvent("rate limited", trace.WithAttributes(
+			attribute.Key("rate_limit.rps").Float64(rps),
+			attribute.Key("rate_limit.burst").Int(burst),
+		))
+		rejected.Add(ctx, 1, metric.WithAttributes(semconv.RPCMethodKey.String(method)))
+		return status.Errorf(codes.ResourceExhausted, "rate limit of %g requests per second exceeded", rps)
+	}
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+	return unary, stream, nil
+}
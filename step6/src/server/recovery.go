@@ -0,0 +1,73 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// panics counts the panics recovered by recoverPanic. It is created from the
+// global MeterProvider, which forwards it to the provider set by initMeter.
+var panics, _ = otel.Meter("server").Int64Counter("shakesapp.server.panics",
+	metric.WithDescription("Number of panics recovered in the handlers and the goroutines that they start."),
+	metric.WithUnit("{panic}"))
+
+// recoverPanic, deferred by a handler or by a goroutine that it starts, turns
+// a panic into an INTERNAL error in *err, so that a bug in the matching code
+// fails the RPC instead of the whole server. The stack trace of the panic is
+// logged and recorded as an exception event on the span of ctx, and the panic
+// is counted with where, the method or the span of the goroutine.
+func recoverPanic(ctx context.Context, where string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	slog.ErrorContext(ctx, "recovered from panic", "where", where, "panic", fmt.Sprint(r), "stack", stack)
+	trace.SpanFromContext(ctx).AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+		semconv.ExceptionTypeKey.String(fmt.Sprintf("%T", r)),
+		semconv.ExceptionMessageKey.String(fmt.Sprint(r)),
+		semconv.ExceptionStacktraceKey.String(stack),
+	))
+	panics.Add(ctx, 1, metric.WithAttributes(attribute.Key("where").String(where)))
+	*err = status.Errorf(codes.Internal, "panic: %v", r)
+}
+
+// newRecoveryInterceptors returns the interceptors that recover the panics of
+// the handlers with recoverPanic. The goroutines started by the handlers,
+// which the interceptors can't see, defer recoverPanic themselves.
+func newRecoveryInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverPanic(ctx, info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverPanic(ss.Context(), info.FullMethod, &err)
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
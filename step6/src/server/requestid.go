@@ -0,0 +1,61 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"opentelemetry-trace-codelab-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDUnaryInterceptor reads the ID of the request to the client from the
+// x-request-id metadata of the RPC, records it in the request.id attribute of
+// the span of the RPC, and passes it to the handler in its context, so that
+// the logs of the RPC carry it. It must be chained first, so that the access
+// log has the ID too.
+func requestIDUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(incomingRequestID(ctx), req)
+}
+
+// requestIDStreamInterceptor is the stream counterpart of
+// requestIDUnaryInterceptor.
+func requestIDStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: incomingRequestID(ss.Context())})
+}
+
+func incomingRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(telemetry.RequestIDMetadata)
+	if len(ids) == 0 || !telemetry.ValidRequestID(ids[0]) {
+		return ctx
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Key("request.id").String(ids[0]))
+	return telemetry.ContextWithRequestID(ctx, ids[0])
+}
+
+// contextServerStream replaces the context of the wrapped stream.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
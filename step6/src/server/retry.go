@@ -0,0 +1,102 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gax "github.com/googleapis/gax-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultGCSMaxAttempts    = 3
+	defaultGCSInitialBackoff = 100 * time.Millisecond
+	defaultGCSMaxBackoff     = 2 * time.Second
+)
+
+// retryPolicy retries the transient errors of Cloud Storage, such as 429 and
+// 5xx responses, with an exponential backoff. The pauses are jittered so that
+// the concurrent downloads don't retry at the same time.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     gax.Backoff
+	retries     metric.Int64Counter
+}
+
+// newRetryPolicy reads the policy from GCS_MAX_ATTEMPTS, GCS_INITIAL_BACKOFF
+// and GCS_MAX_BACKOFF. The backoffs are durations such as "100ms".
+func newRetryPolicy(retries metric.Int64Counter) (*retryPolicy, error) {
+	p := &retryPolicy{
+		maxAttempts: defaultGCSMaxAttempts,
+		backoff: gax.Backoff{
+			Initial:    defaultGCSInitialBackoff,
+			Max:        defaultGCSMaxBackoff,
+			Multiplier: 2,
+		},
+		retries: retries,
+	}
+	if v := os.Getenv("GCS_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("GCS_MAX_ATTEMPTS must be a positive integer, got %q", v)
+		}
+		p.maxAttempts = n
+	}
+	for env, d := range map[string]*time.Duration{
+		"GCS_INITIAL_BACKOFF": &p.backoff.Initial,
+		"GCS_MAX_BACKOFF":     &p.backoff.Max,
+	} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("%s must be a positive duration, got %q", env, v)
+			}
+			*d = parsed
+		}
+	}
+	return p, nil
+}
+
+// options returns the retry options of the operations traced by span. Each
+// retry is recorded as an event of span and counted.
+func (p *retryPolicy) options(ctx context.Context, span trace.Span) []storage.RetryOption {
+	attempt := 1
+	return []storage.RetryOption{
+		storage.WithBackoff(p.backoff),
+		storage.WithMaxAttempts(p.maxAttempts),
+		// listing and reading objects are idempotent.
+		storage.WithPolicy(storage.RetryAlways),
+		storage.WithErrorFunc(func(err error) bool {
+			if !storage.ShouldRetry(err) {
+				return false
+			}
+			attempt++
+			span.AddEvent("retry", trace.WithAttributes(
+				attribute.Key("attempt").Int(attempt),
+				attribute.Key("error").String(err.Error()),
+			))
+			p.retries.Add(ctx, 1)
+			return true
+		}),
+	}
+}
@@ -24,6 +24,12 @@ const _ = grpc.SupportPackageIsVersion7
 type ShakespeareServiceClient interface {
 	// Accepts a query string and returns the number of lines containing that.
 	GetMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (*ShakespeareResponse, error)
+	// Accepts several query strings and returns the number of lines containing
+	// each of them, counted in a single pass over the corpus.
+	GetMatchCounts(ctx context.Context, in *BatchShakespeareRequest, opts ...grpc.CallOption) (*BatchShakespeareResponse, error)
+	// Accepts a query string and streams the number of lines containing that
+	// as the texts are read, once per text.
+	StreamMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (ShakespeareService_StreamMatchCountClient, error)
 }
 
 type shakespeareServiceClient struct {
@@ -43,12 +49,59 @@ func (c *shakespeareServiceClient) GetMatchCount(ctx context.Context, in *Shakes
 	return out, nil
 }
 
+func (c *shakespeareServiceClient) GetMatchCounts(ctx context.Context, in *BatchShakespeareRequest, opts ...grpc.CallOption) (*BatchShakespeareResponse, error) {
+	out := new(BatchShakespeareResponse)
+	err := c.cc.Invoke(ctx, "/shakesapp.ShakespeareService/GetMatchCounts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shakespeareServiceClient) StreamMatchCount(ctx context.Context, in *ShakespeareRequest, opts ...grpc.CallOption) (ShakespeareService_StreamMatchCountClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ShakespeareService_ServiceDesc.Streams[0], "/shakesapp.ShakespeareService/StreamMatchCount", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shakespeareServiceStreamMatchCountClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ShakespeareService_StreamMatchCountClient interface {
+	Recv() (*PartialMatchCount, error)
+	grpc.ClientStream
+}
+
+type shakespeareServiceStreamMatchCountClient struct {
+	grpc.ClientStream
+}
+
+func (x *shakespeareServiceStreamMatchCountClient) Recv() (*PartialMatchCount, error) {
+	m := new(PartialMatchCount)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ShakespeareServiceServer is the server API for ShakespeareService service.
 // All implementations must embed UnimplementedShakespeareServiceServer
 // for forward compatibility
 type ShakespeareServiceServer interface {
 	// Accepts a query string and returns the number of lines containing that.
 	GetMatchCount(context.Context, *ShakespeareRequest) (*ShakespeareResponse, error)
+	// Accepts several query strings and returns the number of lines containing
+	// each of them, counted in a single pass over the corpus.
+	GetMatchCounts(context.Context, *BatchShakespeareRequest) (*BatchShakespeareResponse, error)
+	// Accepts a query string and streams the number of lines containing that
+	// as the texts are read, once per text.
+	StreamMatchCount(*ShakespeareRequest, ShakespeareService_StreamMatchCountServer) error
 	mustEmbedUnimplementedShakespeareServiceServer()
 }
 
@@ -59,6 +112,12 @@ type UnimplementedShakespeareServiceServer struct {
 func (UnimplementedShakespeareServiceServer) GetMatchCount(context.Context, *ShakespeareRequest) (*ShakespeareResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetMatchCount not implemented")
 }
+func (UnimplementedShakespeareServiceServer) GetMatchCounts(context.Context, *BatchShakespeareRequest) (*BatchShakespeareResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMatchCounts not implemented")
+}
+func (UnimplementedShakespeareServiceServer) StreamMatchCount(*ShakespeareRequest, ShakespeareService_StreamMatchCountServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMatchCount not implemented")
+}
 func (UnimplementedShakespeareServiceServer) mustEmbedUnimplementedShakespeareServiceServer() {}
 
 // UnsafeShakespeareServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -90,6 +149,45 @@ func _ShakespeareService_GetMatchCount_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShakespeareService_GetMatchCounts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchShakespeareRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShakespeareServiceServer).GetMatchCounts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shakesapp.ShakespeareService/GetMatchCounts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShakespeareServiceServer).GetMatchCounts(ctx, req.(*BatchShakespeareRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShakespeareService_StreamMatchCount_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ShakespeareRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShakespeareServiceServer).StreamMatchCount(m, &shakespeareServiceStreamMatchCountServer{stream})
+}
+
+type ShakespeareService_StreamMatchCountServer interface {
+	Send(*PartialMatchCount) error
+	grpc.ServerStream
+}
+
+type shakespeareServiceStreamMatchCountServer struct {
+	grpc.ServerStream
+}
+
+func (x *shakespeareServiceStreamMatchCountServer) Send(m *PartialMatchCount) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // ShakespeareService_ServiceDesc is the grpc.ServiceDesc for ShakespeareService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -101,7 +199,17 @@ var ShakespeareService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetMatchCount",
 			Handler:    _ShakespeareService_GetMatchCount_Handler,
 		},
+		{
+			MethodName: "GetMatchCounts",
+			Handler:    _ShakespeareService_GetMatchCounts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMatchCount",
+			Handler:       _ShakespeareService_StreamMatchCount_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "shakesapp.proto",
 }
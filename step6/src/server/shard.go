@@ -0,0 +1,101 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// matchWorkers reads from MATCH_WORKERS the number of goroutines that match
+// the corpus in parallel. It defaults to GOMAXPROCS.
+func matchWorkers() (int, error) {
+	v := os.Getenv("MATCH_WORKERS")
+	if v == "" {
+		return runtime.GOMAXPROCS(0), nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("MATCH_WORKERS must be a positive integer, got %q", v)
+	}
+	return n, nil
+}
+
+// shard is the range [lo, hi) of the items handled by one worker.
+type shard struct {
+	index  int
+	lo, hi int
+}
+
+// splitShards splits n items into at most workers contiguous shards of
+// nearly equal sizes.
+func splitShards(n, workers int) []shard {
+	if workers > n {
+		workers = n
+	}
+	shards := make([]shard, workers)
+	for i := range shards {
+		shards[i] = shard{index: i, lo: i * n / workers, hi: (i + 1) * n / workers}
+	}
+	return shards
+}
+
+// runShards calls fn with every shard in its own goroutine, within a
+// server.matchShard span, so that the trace shows the shards running in
+// parallel. It waits for all of them and returns the first error, which
+// cancels the context of the others.
+func runShards(ctx context.Context, shards []shard, fn func(ctx context.Context, sh shard) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tr := otel.Tracer("server")
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for _, sh := range shards {
+		wg.Add(1)
+		go func(sh shard) {
+			defer wg.Done()
+			ctx, span := tr.Start(ctx, "server.matchShard", trace.WithAttributes(
+				attribute.Key("shard").Int(sh.index),
+				attribute.Key("items").Int(sh.hi-sh.lo),
+			))
+			defer span.End()
+			// the panics of the shard don't reach the recovery interceptor,
+			// which runs in the goroutine of the handler.
+			err := func() (err error) {
+				defer recoverPanic(ctx, "server.matchShard", &err)
+				return fn(ctx, sh)
+			}()
+			if err != nil {
+				spanError(span, err)
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(sh)
+	}
+	wg.Wait()
+	return firstErr
+}
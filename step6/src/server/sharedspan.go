@@ -0,0 +1,81 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sharedSpans holds the spans of the counts shared by the concurrent requests
+// for the same query, by query key, while they run. The span of a shared count
+// is the root of its own trace, since it outlives the request that started it,
+// and links to the spans of the requests that wait for it.
+type sharedSpans struct {
+	mu    sync.Mutex
+	spans map[string]sharedSpan
+}
+
+type sharedSpan struct {
+	span   trace.Span
+	leader trace.SpanContext
+}
+
+// start starts the span of the count of key and links it and the span of the
+// request in ctx, which started it, to each other. It returns the context of
+// the count and end, which must be called once the count is done.
+func (s *sharedSpans) start(ctx context.Context, key string) (context.Context, func()) {
+	leader := trace.SpanFromContext(ctx)
+	ctx, span := otel.Tracer("server").Start(ctx, "server.sharedCount",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.Link{SpanContext: leader.SpanContext()}),
+	)
+	leader.AddLink(trace.Link{SpanContext: span.SpanContext()})
+	s.mu.Lock()
+	if s.spans == nil {
+		s.spans = make(map[string]sharedSpan)
+	}
+	s.spans[key] = sharedSpan{span: span, leader: leader.SpanContext()}
+	s.mu.Unlock()
+	end := func() {
+		s.mu.Lock()
+		delete(s.spans, key)
+		s.mu.Unlock()
+		span.End()
+	}
+	return ctx, end
+}
+
+// link links the span of the count of key, while it runs, and the span of the
+// request in ctx that waits for it to each other. The requests that join a
+// count before its span has started aren't linked, and neither is the request
+// that started it, which is linked by start.
+func (s *sharedSpans) link(ctx context.Context, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shared, ok := s.spans[key]
+	if !ok {
+		return
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if sc.Equal(shared.leader) {
+		return
+	}
+	shared.span.AddLink(trace.Link{SpanContext: sc})
+	trace.SpanFromContext(ctx).AddLink(trace.Link{SpanContext: shared.span.SpanContext()})
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"opentelemetry-trace-codelab-go/server/shakesapp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StreamMatchCount counts the lines that match the query of req like
+// GetMatchCount, and sends the count of the lines read so far every time a
+// text has been read, so that the client sees the count grow while the corpus
+// is read. The texts are always read from their source, even when the corpus
+// is cached, since the cache doesn't keep the boundaries of the texts.
+func (s *serverService) StreamMatchCount(req *shakesapp.ShakespeareRequest, stream shakesapp.ShakespeareService_StreamMatchCountServer) (err error) {
+	ctx := stream.Context()
+	pprof.Do(ctx, profileLabels(ctx, "StreamMatchCount", req.MatchMode), func(ctx context.Context) {
+		err = s.streamMatchCount(ctx, req, stream)
+	})
+	return err
+}
+
+func (s *serverService) streamMatchCount(ctx context.Context, req *shakesapp.ShakespeareRequest, stream shakesapp.ShakespeareService_StreamMatchCountServer) (err error) {
+	start := time.Now()
+	defer func() {
+		s.metrics.recordRequest(ctx, "StreamMatchCount", req.MatchMode, time.Since(start), err)
+	}()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Key("match_mode").String(req.MatchMode.String()),
+		attribute.Key("case_sensitive").Bool(req.CaseSensitive),
+	)
+
+	m, err := newMatcher(ctx, req, s.patterns, s.lowercaseLines)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid query: %v", err)
+	}
+	readCorpus := s.corpus.Load()
+	if readCorpus == nil {
+		return status.Error(codes.Unavailable, "corpus is not ready")
+	}
+
+	// stop reading the corpus when a message can't be sent.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var count atomic.Int64
+	var mu sync.Mutex
+	var files int32
+	var sendErr error
+	readStart := time.Now()
+	stats, err := (*readCorpus)(ctx, func(line string) {
+		if m.lower {
+			line = strings.ToLower(line)
+		}
+		if m.match(line) {
+			count.Add(1)
+		}
+	}, func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sendErr != nil {
+			return
+		}
+		files++
+		sendErr = stream.Send(&shakesapp.PartialMatchCount{
+			File:       name,
+			Files:      files,
+			MatchCount: count.Load(),
+		})
+		if sendErr != nil {
+			cancel()
+		}
+	})
+	s.metrics.recordRead(ctx, time.Since(readStart), stats)
+	span.SetAttributes(
+		attribute.Key("files").Int(int(files)),
+		attribute.Key("matched").Int64(count.Load()),
+	)
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		// stop once the client is gone or the deadline has passed.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return fmt.Errorf("fails to read files: %s", err)
+	}
+	return nil
+}